@@ -288,7 +288,11 @@ export function CreateServer() {
 									<SelectContent>
 										<SelectItem value="vanilla">Vanilla</SelectItem>
 										<SelectItem value="paper">Paper</SelectItem>
+										<SelectItem value="purpur">Purpur</SelectItem>
 										<SelectItem value="forge">Forge</SelectItem>
+										<SelectItem value="neoforge">NeoForge</SelectItem>
+										<SelectItem value="fabric">Fabric</SelectItem>
+										<SelectItem value="quilt">Quilt</SelectItem>
 									</SelectContent>
 								</Select>
 
@@ -3,8 +3,12 @@ package main
 import (
 	"beelder/internal/api/handlers"
 	"beelder/internal/api/services"
+	"beelder/internal/api/services/registry"
+	"beelder/internal/plans"
+	"beelder/internal/servertypes"
 	config "beelder/internal/config/api"
 	"beelder/pkg/messaging/redpanda"
+	"beelder/pkg/validation"
 	"log"
 	"net/http"
 	"os"
@@ -45,26 +49,60 @@ func main() {
 }
 
 func setupRoutes(app *fiber.App) {
-	// Service configurations
-	producerConfig := &redpanda.RedpandaConfig{
+	// Messaging clients
+	producer := redpanda.NewRedpandaProducer(&redpanda.RedpandaConfig{
 		Brokers: []string{config.ApiEnvs.Broker},
 		Topic:   config.ApiEnvs.ServerCommdansTopic,
-	}
+	})
+	producer.Connect()
 
-	consumerConfig := &redpanda.RedpandaConsumerConfig{
+	consumer := redpanda.NewRedpandaConsumer(&redpanda.RedpandaConsumerConfig{
 		Brokers: []string{config.ApiEnvs.Broker},
 		Topic:   config.ApiEnvs.ServerProgressTopic,
 		GroupID: config.ApiEnvs.GroupID,
+	})
+	consumer.Connect()
+
+	// The registry reads the same topic with its own consumer group so it sees every event
+	registryConsumer := redpanda.NewRedpandaConsumer(&redpanda.RedpandaConsumerConfig{
+		Brokers: []string{config.ApiEnvs.Broker},
+		Topic:   config.ApiEnvs.ServerProgressTopic,
+		GroupID: config.ApiEnvs.GroupID + "-registry",
+	})
+	registryConsumer.Connect()
+
+	store, err := registry.NewStore(config.ApiEnvs.RegistryPath)
+	if err != nil {
+		log.Fatal("Failed to open server registry:", err)
+	}
+
+	serverTypes, err := servertypes.Load(config.ApiEnvs.ServerTypesDir)
+	if err != nil {
+		log.Fatal("Failed to load server types:", err)
+	}
+
+	catalog, err := plans.Load(config.ApiEnvs.PlansFile)
+	if err != nil {
+		log.Fatal("Failed to load plans:", err)
+	}
+	if err := catalog.CheckServerTypes(serverTypes.Names()); err != nil {
+		log.Fatal("Invalid plans:", err)
 	}
+	// Requests are validated against the same server types and plans as the worker
+	validation.SetCatalog(serverTypes, catalog)
 
 	// Initialize services
-	serverService := services.NewServerService(producerConfig)
-	sse := services.NewSSEService(consumerConfig)
+	registryService := services.NewRegistryService(registryConsumer, store)
+	registryService.Run()
+	serverService := services.NewServerService(producer, registryService, serverTypes, catalog)
+	planService := services.NewPlanService(catalog)
+	sse := services.NewSSEService(consumer)
 	sse.Run()
 
 	// Initialize handlers
 	serverHandler := handlers.NewServerHandler(serverService)
 	sseHandler := handlers.NewSSEHandler(sse)
+	planHandler := handlers.NewPlanHandler(planService)
 
 	// Register routes
 	api := app.Group("/api")
@@ -72,4 +110,5 @@ func setupRoutes(app *fiber.App) {
 
 	serverHandler.RegisterRoutes(v1)
 	sseHandler.RegisterRoutes(v1)
+	planHandler.RegisterRoutes(v1)
 }
\ No newline at end of file
@@ -1,13 +1,23 @@
 package main
 
 import (
+	config "beelder/internal/config/worker"
 	"beelder/internal/worker"
 	"log/slog"
 )
 
 func main() {
 	logger := slog.Default()
-	worker := worker.NewWorker()
+	if err := config.Load(); err != nil {
+		logger.Error("failed to load worker configuration", "error", err)
+		return
+	}
+
+	worker, err := worker.NewWorker()
+	if err != nil {
+		logger.Error("failed to create worker", "error", err)
+		return
+	}
 
 	if err := worker.Start(); err != nil {
 		logger.Error("worker failed", "error", err)
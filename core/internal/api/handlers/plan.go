@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"beelder/internal/api/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type PlanHandler struct {
+	planService *services.PlanService
+}
+
+func NewPlanHandler(planService *services.PlanService) *PlanHandler {
+	return &PlanHandler{
+		planService: planService,
+	}
+}
+
+func (h *PlanHandler) RegisterRoutes(routes fiber.Router) {
+	routes.Get("/plans", h.listPlans)
+}
+
+func (h *PlanHandler) listPlans(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": h.planService.ListPlans(),
+	})
+}
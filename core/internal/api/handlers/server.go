@@ -2,10 +2,15 @@ package handlers
 
 import (
 	"beelder/internal/api/services"
+	"beelder/internal/api/services/recommendation"
+	"beelder/internal/api/services/registry"
+	"beelder/internal/servertypes"
 	"beelder/internal/types"
 	"beelder/pkg/validation"
+	"errors"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 )
 
 type ServerHandler struct {
@@ -22,7 +27,13 @@ func (h *ServerHandler) RegisterRoutes(routes fiber.Router) {
 	servers := routes.Group("/server")
 
 	servers.Post("", validation.ValidateBody[types.CreateServerConfig], h.createServer)
+	servers.Get("", validation.ValidateQuery[types.ListServersParams], h.listServers)
 	servers.Get("/recommended-plans", validation.ValidateQuery[types.RecommendationServerParams], h.getRecommendedPlans)
+	servers.Get("/:id", h.getServer)
+	servers.Post("/:id/stop", h.stopServer)
+	servers.Post("/:id/start", h.startServer)
+	servers.Post("/:id/restart", h.restartServer)
+	servers.Delete("/:id", validation.ValidateQuery[types.DeleteServerParams], h.deleteServer)
 }
 
 func (h *ServerHandler) createServer(c *fiber.Ctx) error {
@@ -50,6 +61,13 @@ func (h *ServerHandler) getRecommendedPlans(c *fiber.Ctx) error {
 
 	plans, err := h.serverService.GetRecommendedPlans(params)
 
+	if errors.Is(err, servertypes.ErrUnknownServerType) ||
+		errors.Is(err, recommendation.ErrUnknownRegion) ||
+		errors.Is(err, recommendation.ErrUnsupportedVersion) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
@@ -60,3 +78,84 @@ func (h *ServerHandler) getRecommendedPlans(c *fiber.Ctx) error {
 			"data": plans,
 		})
 }
+
+func (h *ServerHandler) listServers(c *fiber.Ctx) error {
+	params := c.Locals("validated").(*types.ListServersParams)
+
+	servers, err := h.serverService.ListServers(params)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": servers,
+	})
+}
+
+func (h *ServerHandler) getServer(c *fiber.Ctx) error {
+	server, err := h.serverService.GetServer(c.Params("id"))
+	if errors.Is(err, registry.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Server not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": server,
+	})
+}
+
+func (h *ServerHandler) stopServer(c *fiber.Ctx) error {
+	return h.sendLifecycleCommand(c, "Server stop requested", h.serverService.StopServer)
+}
+
+func (h *ServerHandler) startServer(c *fiber.Ctx) error {
+	return h.sendLifecycleCommand(c, "Server start requested", h.serverService.StartServer)
+}
+
+func (h *ServerHandler) restartServer(c *fiber.Ctx) error {
+	return h.sendLifecycleCommand(c, "Server restart requested", h.serverService.RestartServer)
+}
+
+func (h *ServerHandler) deleteServer(c *fiber.Ctx) error {
+	params := c.Locals("validated").(*types.DeleteServerParams)
+
+	return h.sendLifecycleCommand(c, "Server deletion requested", func(serverId string) error {
+		return h.serverService.DeleteServer(serverId, params.VolumePolicy)
+	})
+}
+
+// sendLifecycleCommand validates the server id path param and publishes the command.
+// Lifecycle commands run asynchronously, progress is streamed through the SSE endpoint.
+func (h *ServerHandler) sendLifecycleCommand(c *fiber.Ctx, message string, send func(serverId string) error) error {
+	serverId := c.Params("id")
+	if _, err := uuid.Parse(serverId); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid server id",
+		})
+	}
+
+	if _, err := h.serverService.GetServer(serverId); errors.Is(err, registry.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Server not found",
+		})
+	}
+
+	if err := send(serverId); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": message,
+		"id": serverId,
+	})
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
 	"github.com/valyala/fasthttp"
 )
 
@@ -30,7 +31,8 @@ func (sh *SSEHandler) RegisterRoutes(routes fiber.Router) {
 }
 
 func (sh *SSEHandler) HandleSSE(c *fiber.Ctx) error {
-	serverID := c.Params("serverID")
+	// The client outlives the request, and fasthttp reuses the memory of the request params
+	serverID := utils.CopyString(c.Params("serverID"))
 	if serverID == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "serverID is required",
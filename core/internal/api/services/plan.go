@@ -0,0 +1,17 @@
+package services
+
+import "beelder/internal/plans"
+
+type PlanService struct {
+	plans *plans.Catalog
+}
+
+// NewPlanService serves the plans of the catalog the worker sizes servers with.
+func NewPlanService(catalog *plans.Catalog) *PlanService {
+	return &PlanService{plans: catalog}
+}
+
+// ListPlans returns the plans from the smallest memory limit to the largest.
+func (s *PlanService) ListPlans() []plans.Plan {
+	return s.plans.Plans()
+}
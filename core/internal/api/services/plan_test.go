@@ -0,0 +1,43 @@
+package services
+
+import (
+	"beelder/internal/plans"
+	"encoding/json"
+	"testing"
+)
+
+func TestListPlans(t *testing.T) {
+	catalog, err := plans.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listed := NewPlanService(catalog).ListPlans()
+	if len(listed) != len(catalog.Plans()) {
+		t.Fatalf("%d plans listed, want the %d plans of the catalog", len(listed), len(catalog.Plans()))
+	}
+	for _, plan := range listed {
+		data, err := json.Marshal(plan)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fields map[string]any
+		if err := json.Unmarshal(data, &fields); err != nil {
+			t.Fatal(err)
+		}
+		if fields["name"] != plan.Name || fields["disk_quota_mb"] != float64(plan.DiskQuotaMB) {
+			t.Errorf("plan %s listed as %s, want the fields of the plan", plan.Name, data)
+		}
+	}
+}
+
+func TestListPlansOfEmptyCatalog(t *testing.T) {
+	data, err := json.Marshal(NewPlanService(&plans.Catalog{}).ListPlans())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A JSON null would break the clients iterating over the plans
+	if string(data) != "[]" {
+		t.Errorf("empty catalog listed as %s, want []", data)
+	}
+}
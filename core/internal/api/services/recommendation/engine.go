@@ -0,0 +1,194 @@
+// Package recommendation ranks the plans of the catalog for a server.
+//
+// The engine estimates the heap a server needs from its server type, players, mods or plugins and
+// Minecraft version, then scores every plan on how closely it covers the estimate.
+package recommendation
+
+import (
+	"beelder/internal/plans"
+	"beelder/internal/servertypes"
+	"beelder/internal/types"
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var (
+	// ErrUnknownRegion is returned when servers can not be created in the region.
+	ErrUnknownRegion = errors.New("unknown region")
+	// ErrUnsupportedVersion is returned when the server type does not support the server version.
+	ErrUnsupportedVersion = errors.New("unsupported server version")
+)
+
+// Heap estimates in MB. Modded servers keep the mod registries in memory and load more content per player.
+const (
+	baseHeapMB         = 1024
+	moddedBaseHeapMB   = 2560
+	playerHeapMB       = 40
+	moddedPlayerHeapMB = 72
+	pluginHeapMB       = 16
+	modHeapMB          = 48
+)
+
+// Scores of the plans fitting the server go from minFitScore to 100, the closest fit scoring highest.
+// Plans too small for the server score below maxShortScore, the closest to the estimate scoring highest.
+const (
+	minFitScore   = 60
+	maxShortScore = 40
+)
+
+// tightFit is the share of the heap above which a fitting plan leaves little headroom.
+const tightFit = 0.9
+
+// Engine recommends the plans of a catalog for the server types of a registry.
+type Engine struct {
+	serverTypes *servertypes.Registry
+	plans       *plans.Catalog
+}
+
+func NewEngine(serverTypes *servertypes.Registry, catalog *plans.Catalog) *Engine {
+	return &Engine{serverTypes: serverTypes, plans: catalog}
+}
+
+// demand is what a server needs from a plan.
+type demand struct {
+	serverType string
+	region     string
+	players    int
+	heapMB     int64
+}
+
+// Recommend returns every plan of the catalog, ranked from the best fit to the worst.
+// The recommendation is the best plan fitting the server, or the largest plan able to run it when none fits.
+// It returns an error wrapping servertypes.ErrUnknownServerType, ErrUnknownRegion or ErrUnsupportedVersion
+// when the parameters can not be served.
+func (e *Engine) Recommend(params *types.RecommendationServerParams) (types.RecommendationResponse, error) {
+	var response types.RecommendationResponse
+
+	definition, err := e.serverTypes.Lookup(params.ServerType)
+	if err != nil {
+		return response, err
+	}
+	if !e.plans.HasRegion(params.Region) {
+		return response, fmt.Errorf("%w: %q (must be one of %v)", ErrUnknownRegion, params.Region, e.plans.Regions())
+	}
+	versionFactor, err := worldFactor(definition, params.ServerVersion)
+	if err != nil {
+		return response, err
+	}
+
+	d := demand{
+		serverType: definition.Name,
+		region:     params.Region,
+		players:    params.PlayerCount,
+		heapMB:     estimateHeapMB(definition, params.PlayerCount, params.ModCount, versionFactor),
+	}
+
+	catalog := e.plans.Plans()
+	for _, plan := range catalog {
+		response.Plans = append(response.Plans, score(&plan, d))
+	}
+	// The catalog is sorted by size, so the stable sort keeps the smaller plan first on equal scores
+	slices.SortStableFunc(response.Plans, func(a, b types.PlanRecommendation) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+
+	for _, recommendation := range response.Plans {
+		if recommendation.Fits {
+			response.Recommendation = recommendation.Plan
+			return response, nil
+		}
+	}
+	// No plan fits, the largest plan able to run the server is ranked first
+	if len(response.Plans) > 0 && response.Plans[0].Score > 0 {
+		first := &response.Plans[0]
+		first.Reasons = append(first.Reasons, "no plan fits the server, this is the largest plan able to run it")
+		response.Recommendation = first.Plan
+	}
+	return response, nil
+}
+
+// estimateHeapMB returns the heap a server of the type needs for its players and mods, or plugins for plugin servers.
+// Only the players, mods and plugins grow with the world sizes of newer versions.
+func estimateHeapMB(definition *servertypes.Definition, players int, mods int, versionFactor float64) int64 {
+	baseMB, perPlayerMB, perModMB := int64(baseHeapMB), float64(playerHeapMB), float64(pluginHeapMB)
+	if definition.Modded {
+		baseMB, perPlayerMB, perModMB = moddedBaseHeapMB, moddedPlayerHeapMB, modHeapMB
+	}
+	return baseMB + int64((float64(players)*perPlayerMB+float64(mods)*perModMB)*versionFactor)
+}
+
+// worldFactor returns how much the player and mod memory grows with the Minecraft version of the server.
+// Worlds got taller in 1.18 and heavier with each release, the latest worlds are assumed when the version is empty.
+func worldFactor(definition *servertypes.Definition, serverVersion string) (float64, error) {
+	if serverVersion == "" {
+		return 1.1, nil
+	}
+	if !definition.SupportsVersion(serverVersion) {
+		return 0, fmt.Errorf("%w: %s %s (must be one of %v)", ErrUnsupportedVersion, definition.Name, serverVersion, definition.Versions)
+	}
+
+	version, ok := definition.MinecraftVersion(serverVersion)
+	if !ok {
+		if definition.VersionScheme == servertypes.VersionSchemeNone {
+			return 1.1, nil
+		}
+		return 0, fmt.Errorf("%w: can not read the Minecraft version of %s %s", ErrUnsupportedVersion, definition.Name, serverVersion)
+	}
+	if !definition.SupportsMinecraftVersion(version) {
+		return 0, fmt.Errorf("%w: %s supports Minecraft %s and newer, not %s", ErrUnsupportedVersion, definition.Name, definition.MinMinecraftVersion, version)
+	}
+
+	switch {
+	case version.Before(servertypes.MinecraftVersion{Minor: 13}):
+		return 0.8, nil
+	case version.Before(servertypes.MinecraftVersion{Minor: 18}):
+		return 1.0, nil
+	default:
+		return 1.1, nil
+	}
+}
+
+// score rates how well a plan covers the demand of a server and explains it.
+func score(plan *plans.Plan, d demand) types.PlanRecommendation {
+	recommendation := types.PlanRecommendation{Plan: plan.Name}
+
+	if !plan.AllowsServerType(d.serverType) {
+		recommendation.Reasons = append(recommendation.Reasons, fmt.Sprintf("does not run %s servers", d.serverType))
+	}
+	if !plan.AvailableIn(d.region) {
+		recommendation.Reasons = append(recommendation.Reasons, fmt.Sprintf("not offered in %s", d.region))
+	}
+	if len(recommendation.Reasons) > 0 {
+		return recommendation
+	}
+
+	enoughHeap := plan.HeapMaxMB >= d.heapMB
+	enoughPlayers := plan.MaxPlayers >= d.players
+	recommendation.Fits = enoughHeap && enoughPlayers
+
+	if recommendation.Fits {
+		usage := float64(d.heapMB) / float64(plan.HeapMaxMB)
+		recommendation.Score = minFitScore + int(usage*(100-minFitScore))
+		recommendation.Reasons = append(recommendation.Reasons,
+			fmt.Sprintf("%d MB heap covers the estimated %d MB", plan.HeapMaxMB, d.heapMB),
+			fmt.Sprintf("sized for up to %d players", plan.MaxPlayers),
+		)
+		if usage > tightFit {
+			recommendation.Reasons = append(recommendation.Reasons, "little headroom for more players or mods")
+		}
+		return recommendation
+	}
+
+	// The further the plan is from the demand, the lower it scores, it always scores at least 1 as it can run the server
+	coverage := min(float64(plan.HeapMaxMB)/float64(d.heapMB), float64(plan.MaxPlayers)/float64(d.players), 1)
+	recommendation.Score = max(1, int(coverage*maxShortScore))
+	if !enoughHeap {
+		recommendation.Reasons = append(recommendation.Reasons, fmt.Sprintf("%d MB heap is below the estimated %d MB", plan.HeapMaxMB, d.heapMB))
+	}
+	if !enoughPlayers {
+		recommendation.Reasons = append(recommendation.Reasons, fmt.Sprintf("sized for %d players, not %d", plan.MaxPlayers, d.players))
+	}
+	return recommendation
+}
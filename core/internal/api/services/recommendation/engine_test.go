@@ -0,0 +1,256 @@
+package recommendation
+
+import (
+	"beelder/internal/plans"
+	"beelder/internal/servertypes"
+	"beelder/internal/types"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func newTestEngine(t *testing.T) *Engine {
+	t.Helper()
+	serverTypes, err := servertypes.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog, err := plans.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewEngine(serverTypes, catalog)
+}
+
+// planResult returns the recommendation of a plan in the response.
+func planResult(t *testing.T, response types.RecommendationResponse, plan string) types.PlanRecommendation {
+	t.Helper()
+	i := slices.IndexFunc(response.Plans, func(p types.PlanRecommendation) bool { return p.Plan == plan })
+	if i < 0 {
+		t.Fatalf("plan %s missing from the response", plan)
+	}
+	return response.Plans[i]
+}
+
+func hasReason(recommendation types.PlanRecommendation, reason string) bool {
+	return slices.ContainsFunc(recommendation.Reasons, func(r string) bool { return strings.Contains(r, reason) })
+}
+
+func TestEstimateHeapMB(t *testing.T) {
+	serverTypes, err := servertypes.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 10 players and 20 mods or plugins on the latest worlds
+	want := map[string]int64{
+		// Unmodded servers weigh 40MB per player and 16MB per plugin
+		"vanilla": 1024 + 440 + 352,
+		"paper":   1024 + 440 + 352,
+		"purpur":  1024 + 440 + 352,
+		// Modded servers start larger, and weigh 72MB per player and 48MB per mod
+		"fabric":   2560 + 792 + 1056,
+		"quilt":    2560 + 792 + 1056,
+		"forge":    2560 + 792 + 1056,
+		"neoforge": 2560 + 792 + 1056,
+	}
+	for _, name := range serverTypes.Names() {
+		t.Run(name, func(t *testing.T) {
+			definition, _ := serverTypes.Lookup(name)
+			wantMB, ok := want[name]
+			if !ok {
+				t.Fatalf("no expected heap for the %s server type", name)
+			}
+			if got := estimateHeapMB(definition, 10, 20, 1.1); got != wantMB {
+				t.Errorf("estimateHeapMB() = %d MB, want %d MB", got, wantMB)
+			}
+		})
+	}
+}
+
+func TestWorldFactor(t *testing.T) {
+	serverTypes, err := servertypes.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		serverType string
+		version    string
+		want       float64
+		wantErr    error
+	}{
+		{"vanilla", "", 1.1, nil},
+		{"vanilla", "1.12.2", 0.8, nil},
+		{"vanilla", "1.16.5", 1.0, nil},
+		{"vanilla", "1.18", 1.1, nil},
+		{"forge", "1.20.1-47.2.0", 1.1, nil},
+		{"neoforge", "21.1.77", 1.1, nil},
+		// Older than the oldest version of the server type
+		{"fabric", "1.12.2", 0, ErrUnsupportedVersion},
+		{"neoforge", "20.1.0", 0, ErrUnsupportedVersion},
+		{"vanilla", "latest", 0, ErrUnsupportedVersion},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.serverType+" "+tt.version, func(t *testing.T) {
+			definition, _ := serverTypes.Lookup(tt.serverType)
+			got, err := worldFactor(definition, tt.version)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("worldFactor() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("worldFactor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecommend(t *testing.T) {
+	engine := newTestEngine(t)
+
+	tests := []struct {
+		name               string
+		params             types.RecommendationServerParams
+		wantRecommendation string
+		wantErr            error
+		// check looks at the ranked plans, optional
+		check func(t *testing.T, response types.RecommendationResponse)
+	}{
+		{
+			name:               "small vanilla server",
+			params:             types.RecommendationServerParams{ServerType: "vanilla", Region: "eu-west-1", PlayerCount: 5},
+			wantRecommendation: "2GB",
+		},
+		{
+			name:               "players at the plan capacity",
+			params:             types.RecommendationServerParams{ServerType: "vanilla", Region: "eu-west-1", PlayerCount: 10},
+			wantRecommendation: "2GB",
+		},
+		{
+			name:               "players over the plan capacity",
+			params:             types.RecommendationServerParams{ServerType: "vanilla", Region: "eu-west-1", PlayerCount: 11},
+			wantRecommendation: "4GB",
+			check: func(t *testing.T, response types.RecommendationResponse) {
+				small := planResult(t, response, "2GB")
+				if small.Fits || !hasReason(small, "sized for 10 players, not 11") {
+					t.Errorf("2GB plan = %+v, want it too small for 11 players", small)
+				}
+			},
+		},
+		{
+			name:               "30 players",
+			params:             types.RecommendationServerParams{ServerType: "vanilla", Region: "eu-west-1", PlayerCount: 30},
+			wantRecommendation: "4GB",
+		},
+		{
+			name:               "31 players",
+			params:             types.RecommendationServerParams{ServerType: "vanilla", Region: "eu-west-1", PlayerCount: 31},
+			wantRecommendation: "6GB",
+		},
+		{
+			// 6GB is sized for 50 players but not for the heap of 100
+			name:               "100 players",
+			params:             types.RecommendationServerParams{ServerType: "vanilla", Region: "eu-west-1", PlayerCount: 100},
+			wantRecommendation: "8GB",
+			check: func(t *testing.T, response types.RecommendationResponse) {
+				if plan := planResult(t, response, "6GB"); plan.Fits || !hasReason(plan, "5120 MB heap is below the estimated 5424 MB") {
+					t.Errorf("6GB plan = %+v, want its heap too small", plan)
+				}
+			},
+		},
+		{
+			name:               "plugins grow the heap of a plugin server",
+			params:             types.RecommendationServerParams{ServerType: "paper", Region: "eu-west-1", PlayerCount: 5, ModCount: 40},
+			wantRecommendation: "4GB",
+		},
+		{
+			name:               "modded server on a plan that does not run it",
+			params:             types.RecommendationServerParams{ServerType: "forge", Region: "eu-west-1", PlayerCount: 5},
+			wantRecommendation: "4GB",
+			check: func(t *testing.T, response types.RecommendationResponse) {
+				small := planResult(t, response, "2GB")
+				if small.Score != 0 || small.Fits || !hasReason(small, "does not run forge servers") {
+					t.Errorf("2GB plan = %+v, want it unable to run forge", small)
+				}
+				if last := response.Plans[len(response.Plans)-1]; last.Plan != "2GB" {
+					t.Errorf("last plan = %s, want 2GB ranked last", last.Plan)
+				}
+			},
+		},
+		{
+			// The base heap of Fabric and Quilt servers is larger than the heap of the smallest plan
+			name:               "light modded server",
+			params:             types.RecommendationServerParams{ServerType: "fabric", Region: "eu-west-1", PlayerCount: 5},
+			wantRecommendation: "4GB",
+			check: func(t *testing.T, response types.RecommendationResponse) {
+				if small := planResult(t, response, "2GB"); small.Score != 0 || !hasReason(small, "does not run fabric servers") {
+					t.Errorf("2GB plan = %+v, want it unable to run fabric", small)
+				}
+			},
+		},
+		{
+			name:               "large modpack",
+			params:             types.RecommendationServerParams{ServerType: "neoforge", Region: "eu-west-1", PlayerCount: 10, ModCount: 100},
+			wantRecommendation: "12GB",
+		},
+		{
+			name:               "large modpack in a region without the large plan",
+			params:             types.RecommendationServerParams{ServerType: "neoforge", Region: "sa-east-1", PlayerCount: 10, ModCount: 100},
+			wantRecommendation: "8GB",
+			check: func(t *testing.T, response types.RecommendationResponse) {
+				large := planResult(t, response, "12GB")
+				if large.Score != 0 || !hasReason(large, "not offered in sa-east-1") {
+					t.Errorf("12GB plan = %+v, want it not offered", large)
+				}
+				if first := response.Plans[0]; first.Fits || !hasReason(first, "no plan fits the server") {
+					t.Errorf("first plan = %+v, want the largest plan able to run the server", first)
+				}
+			},
+		},
+		{
+			name:    "region not served by the catalog",
+			params:  types.RecommendationServerParams{ServerType: "vanilla", Region: "mars-1", PlayerCount: 5},
+			wantErr: ErrUnknownRegion,
+		},
+		{
+			name:    "unknown server type",
+			params:  types.RecommendationServerParams{ServerType: "bukkit", Region: "eu-west-1", PlayerCount: 5},
+			wantErr: servertypes.ErrUnknownServerType,
+		},
+		{
+			name:    "unsupported version",
+			params:  types.RecommendationServerParams{ServerType: "fabric", Region: "eu-west-1", PlayerCount: 5, ServerVersion: "1.12.2"},
+			wantErr: ErrUnsupportedVersion,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := engine.Recommend(&tt.params)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Recommend() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if response.Recommendation != tt.wantRecommendation {
+				t.Errorf("recommendation = %q, want %q (plans %+v)", response.Recommendation, tt.wantRecommendation, response.Plans)
+			}
+			if len(response.Plans) != 5 {
+				t.Errorf("%d plans ranked, want every plan of the catalog", len(response.Plans))
+			}
+			if !slices.IsSortedFunc(response.Plans, func(a, b types.PlanRecommendation) int { return b.Score - a.Score }) {
+				t.Errorf("plans are not ranked by score: %+v", response.Plans)
+			}
+			if response.Plans[0].Plan != tt.wantRecommendation {
+				t.Errorf("first plan = %s, want the recommendation first", response.Plans[0].Plan)
+			}
+			if tt.check != nil {
+				tt.check(t, response)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"beelder/internal/api/services/registry"
+	"beelder/internal/types"
+	"beelder/pkg/messaging"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// registryEvent holds the progress event fields the registry records.
+type registryEvent struct {
+	ServerID    string `json:"server_id"`
+	Status      string `json:"status"`
+	Stage       string `json:"stage"`
+	Message     string `json:"message"`
+	Error       string `json:"error"`
+	Host        string `json:"host"`
+	Port        string `json:"port"`
+	ContainerID string `json:"container_id"`
+	Category    string `json:"category"`
+	Explanation string `json:"explanation"`
+	Logs        string `json:"logs"`
+}
+
+// RegistryService keeps the server registry up to date from the progress topic.
+type RegistryService struct {
+	consumer messaging.Subscriber
+	store    *registry.Store
+	logger   *slog.Logger
+}
+
+// NewRegistryService records the progress events read by consumer, which must already be connected.
+func NewRegistryService(consumer messaging.Subscriber, store *registry.Store) *RegistryService {
+	return &RegistryService{
+		consumer: consumer,
+		store:    store,
+		logger:   slog.Default().With("component", "registry"),
+	}
+}
+
+func (s *RegistryService) Run() {
+	go s.consumer.ReadMessage(s.HandleProgressMessage)
+}
+
+func (s *RegistryService) Stop() error {
+	s.consumer.Disconnect()
+	return s.store.Close()
+}
+
+// RegisterServer records a server as soon as the API accepts its creation.
+func (s *RegistryService) RegisterServer(serverId string, serverConfig *types.CreateServerConfig) error {
+	now := time.Now()
+	return s.store.Update(serverId, func(record *types.ServerRecord) error {
+		record.Config = serverConfig
+		if record.Status == "" {
+			record.Status = "pending"
+		}
+		record.CreatedAt = now
+		record.UpdatedAt = now
+		return nil
+	})
+}
+
+// FailServer marks a registered server as failed at stage, for a creation the worker never received.
+func (s *RegistryService) FailServer(serverId string, stage string, message string) error {
+	return s.store.Update(serverId, func(record *types.ServerRecord) error {
+		record.Status = "error"
+		record.Stage = stage
+		record.Error = message
+		record.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+func (s *RegistryService) ListServers(params *types.ListServersParams) ([]*types.ServerRecord, error) {
+	return s.store.List(registry.Filter{
+		Status:     params.Status,
+		ServerType: params.ServerType,
+	})
+}
+
+// GetServer returns the registry record of a server, or registry.ErrNotFound.
+func (s *RegistryService) GetServer(serverId string) (*types.ServerRecord, error) {
+	return s.store.Get(serverId)
+}
+
+// HandleProgressMessage applies a worker progress event to the server record.
+// Events older than the last applied one are ignored, as messages are processed concurrently.
+func (s *RegistryService) HandleProgressMessage(msg messaging.Message) (bool, error) {
+	var event registryEvent
+	if err := json.Unmarshal(msg.Value, &event); err != nil {
+		s.logger.Error("Failed to unmarshal progress event", "error", err)
+		return true, err
+	}
+
+	if event.ServerID == "" {
+		return true, nil
+	}
+
+	err := s.store.Update(event.ServerID, func(record *types.ServerRecord) error {
+		if msg.Time.Before(record.LastEventAt) {
+			return nil
+		}
+		applyEvent(record, event, msg.Time)
+		return nil
+	})
+	if err != nil {
+		s.logger.Error("Failed to update server record", "server_id", event.ServerID, "error", err)
+		return false, err
+	}
+
+	return true, nil
+}
+
+// applyEvent copies the non empty fields of an event into the record.
+func applyEvent(record *types.ServerRecord, event registryEvent, eventTime time.Time) {
+	if event.Status != "" {
+		record.Status = event.Status
+	}
+	record.Stage = event.Stage
+	record.Message = event.Message
+	record.Error = event.Error
+	if event.Host != "" {
+		record.Host = event.Host
+	}
+	if port, err := strconv.Atoi(event.Port); err == nil {
+		record.Port = port
+	}
+	if event.ContainerID != "" {
+		record.ContainerID = event.ContainerID
+	}
+	// A diagnosis stays until the server starts again
+	if event.Category != "" {
+		record.Failure = &types.ServerFailure{
+			Category:    event.Category,
+			Explanation: event.Explanation,
+			Logs:        event.Logs,
+		}
+	} else if event.Status == "running" {
+		record.Failure = nil
+	}
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = eventTime
+	}
+	record.UpdatedAt = time.Now()
+	record.LastEventAt = eventTime
+}
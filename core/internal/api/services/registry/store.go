@@ -0,0 +1,138 @@
+package registry
+
+import (
+	"beelder/internal/types"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var serversBucket = []byte("servers")
+
+// ErrNotFound is returned when a server is not in the registry.
+var ErrNotFound = errors.New("server not found")
+
+// Filter selects servers when listing, empty fields match everything.
+type Filter struct {
+	Status     string
+	ServerType string
+}
+
+// Store persists server records in an embedded bbolt database, keyed by server id.
+type Store struct {
+	db *bolt.DB
+}
+
+// NewStore opens (or creates) the registry database at path.
+func NewStore(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open registry database: %w", err)
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(serversBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create registry bucket: %w", err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Close closes the underlying database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Put creates or replaces a server record.
+func (s *Store) Put(record *types.ServerRecord) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putRecord(tx.Bucket(serversBucket), record)
+	})
+}
+
+// Update applies fn to the record with the given id inside a single transaction.
+// When the server is not registered yet fn receives a new record with only the id set.
+func (s *Store) Update(id string, fn func(record *types.ServerRecord) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(serversBucket)
+
+		record := &types.ServerRecord{ID: id}
+		if data := bucket.Get([]byte(id)); data != nil {
+			if err := json.Unmarshal(data, record); err != nil {
+				return fmt.Errorf("failed to decode server %s: %w", id, err)
+			}
+		}
+
+		if err := fn(record); err != nil {
+			return err
+		}
+		return putRecord(bucket, record)
+	})
+}
+
+// Get returns the record of a server, or ErrNotFound.
+func (s *Store) Get(id string) (*types.ServerRecord, error) {
+	var record *types.ServerRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(serversBucket).Get([]byte(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		record = &types.ServerRecord{}
+		return json.Unmarshal(data, record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// List returns the servers matching the filter, newest first.
+func (s *Store) List(filter Filter) ([]*types.ServerRecord, error) {
+	records := []*types.ServerRecord{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(serversBucket).ForEach(func(_, data []byte) error {
+			record := &types.ServerRecord{}
+			if err := json.Unmarshal(data, record); err != nil {
+				return err
+			}
+			if filter.matches(record) {
+				records = append(records, record)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list servers: %w", err)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].CreatedAt.After(records[j].CreatedAt)
+	})
+	return records, nil
+}
+
+func (f Filter) matches(record *types.ServerRecord) bool {
+	if f.Status != "" && record.Status != f.Status {
+		return false
+	}
+	if f.ServerType != "" && (record.Config == nil || record.Config.ServerType != f.ServerType) {
+		return false
+	}
+	return true
+}
+
+func putRecord(bucket *bolt.Bucket, record *types.ServerRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode server %s: %w", record.ID, err)
+	}
+	return bucket.Put([]byte(record.ID), data)
+}
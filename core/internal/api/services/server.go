@@ -1,68 +1,103 @@
 package services
 
 import (
+	"beelder/internal/api/services/recommendation"
+	"beelder/internal/plans"
+	"beelder/internal/servertypes"
 	"beelder/internal/types"
-	"beelder/pkg/messaging/redpanda"
+	"beelder/pkg/messaging"
 	"encoding/json"
+	"errors"
 
 	"github.com/google/uuid"
-	"github.com/segmentio/kafka-go"
 )
 
 type ServerService struct {
-	producer *redpanda.RedpandaProducer
+	producer    messaging.Publisher
+	registry    *RegistryService
+	recommender *recommendation.Engine
 }
 
-func NewServerService(brokerConfig *redpanda.RedpandaConfig) *ServerService {
-	producer := redpanda.NewRedpandaProducer(brokerConfig)
-	producer.Connect()
+// NewServerService sends server commands with producer, which must already be connected.
+// The plans of the catalog are recommended for the server types of serverTypes.
+func NewServerService(producer messaging.Publisher, registry *RegistryService, serverTypes *servertypes.Registry, catalog *plans.Catalog) *ServerService {
 	return &ServerService{
-		producer: producer,
+		producer:    producer,
+		registry:    registry,
+		recommender: recommendation.NewEngine(serverTypes, catalog),
 	}
 }
 
 func (s *ServerService) CreateServer(serverConfig *types.CreateServerConfig) (string, error) {
-	// Convert struct to JSON bytes
 	serverId := uuid.New().String()
-	jsonBytes, err := json.Marshal(serverConfig)
-	if err != nil {
+	command := types.ServerCommand{
+		ServerID: serverId,
+		Config:   serverConfig,
+	}
+
+	if err := s.registry.RegisterServer(serverId, serverConfig); err != nil {
 		return "", err
 	}
 
-	// Send message with JSON bytes
-	go s.producer.SendMessage(kafka.Message{
-		Key:   []byte("server.create"),
-		Value: jsonBytes,
-	})
+	if err := s.sendCommand(types.CommandCreateServer, command); err != nil {
+		// The worker never sees the server, it would stay pending forever
+		if failErr := s.registry.FailServer(serverId, "sending_command", "Failed to send the create command: "+err.Error()); failErr != nil {
+			return "", errors.Join(err, failErr)
+		}
+		return "", err
+	}
 	return serverId, nil
 }
 
-func (s *ServerService) GetRecommendedPlans(params *types.RecommendationServerParams) (types.RecommendationResponse, error) {
-	// Simple recommendation logic based on players count and server type
-	var plans types.RecommendationResponse
-
-	switch params.ServerType {
-	case "vanilla", "paper":
-		if params.PlayerCount <= 10 {
-			plans = types.RecommendationResponse{Recommendation: "2GB"}
-		} else if params.PlayerCount <= 30 {
-			plans = types.RecommendationResponse{Recommendation: "4GB"}
-		} else if params.PlayerCount <= 50 {
-			plans = types.RecommendationResponse{Recommendation: "6GB"}
-		} else if params.PlayerCount <= 100 {
-			plans = types.RecommendationResponse{Recommendation: "8GB"}
-		}
-	case "forge":
-		if params.PlayerCount <= 10 {
-			plans = types.RecommendationResponse{Recommendation: "4GB"}
-		} else if params.PlayerCount <= 30 {
-			plans = types.RecommendationResponse{Recommendation: "6GB"}
-		} else if params.PlayerCount <= 50 {
-			plans = types.RecommendationResponse{Recommendation: "8GB"}
-		} else if params.PlayerCount <= 100 {
-			plans = types.RecommendationResponse{Recommendation: "12GB"}
-		}
+func (s *ServerService) ListServers(params *types.ListServersParams) ([]*types.ServerRecord, error) {
+	return s.registry.ListServers(params)
+}
+
+// GetServer returns the registry record of a server, or registry.ErrNotFound.
+func (s *ServerService) GetServer(serverId string) (*types.ServerRecord, error) {
+	return s.registry.GetServer(serverId)
+}
+
+func (s *ServerService) StopServer(serverId string) error {
+	return s.sendCommand(types.CommandStopServer, types.ServerCommand{ServerID: serverId})
+}
+
+func (s *ServerService) StartServer(serverId string) error {
+	return s.sendCommand(types.CommandStartServer, types.ServerCommand{ServerID: serverId})
+}
+
+func (s *ServerService) RestartServer(serverId string) error {
+	return s.sendCommand(types.CommandRestartServer, types.ServerCommand{ServerID: serverId})
+}
+
+// DeleteServer requests the removal of a server. volumePolicy overrides the policy
+// the server was created with, an empty value keeps it.
+func (s *ServerService) DeleteServer(serverId string, volumePolicy string) error {
+	return s.sendCommand(types.CommandDeleteServer, types.ServerCommand{
+		ServerID:     serverId,
+		VolumePolicy: volumePolicy,
+	})
+}
+
+// sendCommand publishes a command envelope on the commands topic, keyed by command so the worker can route it.
+// A correlation id is attached to every command to follow it through the worker logs.
+func (s *ServerService) sendCommand(key string, command types.ServerCommand) error {
+	command.CorrelationID = uuid.New().String()
+
+	// Convert struct to JSON bytes
+	jsonBytes, err := json.Marshal(command)
+	if err != nil {
+		return err
 	}
 
-	return plans, nil
+	// Send message with JSON bytes, the caller reports a failed send
+	return s.producer.SendMessage(messaging.Message{
+		Key:   []byte(key),
+		Value: jsonBytes,
+	})
+}
+
+// GetRecommendedPlans ranks the plans of the catalog for a server, see recommendation.Engine.Recommend.
+func (s *ServerService) GetRecommendedPlans(params *types.RecommendationServerParams) (types.RecommendationResponse, error) {
+	return s.recommender.Recommend(params)
 }
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"beelder/internal/api/services/registry"
+	"beelder/internal/plans"
+	"beelder/internal/servertypes"
+	"beelder/internal/types"
+	"beelder/pkg/messaging"
+	"beelder/pkg/messaging/memory"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// failingPublisher is a broker that can not be reached.
+type failingPublisher struct{}
+
+func (failingPublisher) SendMessage(message messaging.Message) error {
+	return errors.New("broker unreachable")
+}
+
+func (failingPublisher) SendJsonMessage(key string, value interface{}) error {
+	return errors.New("broker unreachable")
+}
+
+func newTestServerService(t *testing.T, producer messaging.Publisher) (*ServerService, *RegistryService) {
+	t.Helper()
+
+	serverTypes, err := servertypes.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog, err := plans.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := registry.NewStore(filepath.Join(t.TempDir(), "registry.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	registryService := NewRegistryService(memory.NewBus().Subscriber("progress", "api"), store)
+	t.Cleanup(func() { registryService.Stop() })
+	return NewServerService(producer, registryService, serverTypes, catalog), registryService
+}
+
+func newTestServerConfig() *types.CreateServerConfig {
+	return &types.CreateServerConfig{
+		Name:          "test server",
+		ServerType:    "vanilla",
+		ServerVersion: "1.21.1",
+		Region:        "eu-west-1",
+		PlayerCount:   5,
+		RamPlan:       "2GB",
+		Difficulty:    "normal",
+	}
+}
+
+func TestCreateServerSendsCommand(t *testing.T) {
+	bus := memory.NewBus()
+	service, registryService := newTestServerService(t, bus.Publisher("commands"))
+
+	serverId, err := service.CreateServer(newTestServerConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The command is sent before CreateServer returns
+	messages := bus.Messages("commands")
+	if len(messages) != 1 || string(messages[0].Key) != types.CommandCreateServer {
+		t.Fatalf("commands = %v, want one %s command", messages, types.CommandCreateServer)
+	}
+	record, err := registryService.GetServer(serverId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Status != "pending" {
+		t.Errorf("status = %q, want pending", record.Status)
+	}
+}
+
+func TestCreateServerFailsWhenCommandIsNotSent(t *testing.T) {
+	service, registryService := newTestServerService(t, failingPublisher{})
+
+	if _, err := service.CreateServer(newTestServerConfig()); err == nil {
+		t.Fatal("CreateServer() succeeded without sending the command")
+	}
+
+	// The registered server is failed, not left pending
+	records, err := registryService.ListServers(&types.ListServersParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("%d servers registered, want 1", len(records))
+	}
+	if record := records[0]; record.Status != "error" || record.Stage != "sending_command" || record.Error == "" {
+		t.Errorf("record = %+v, want it failed at sending_command", record)
+	}
+
+	if err := service.StopServer("srv-1"); err == nil {
+		t.Error("StopServer() succeeded without sending the command")
+	}
+}
@@ -2,22 +2,20 @@ package services
 
 import (
 	"beelder/internal/api/services/sse"
-	"beelder/pkg/messaging/redpanda"
+	"beelder/pkg/messaging"
 	"context"
 	"encoding/json"
-
-	"github.com/segmentio/kafka-go"
 )
 
 type SSEService struct {
-	consumer *redpanda.RedpandaConsumer
+	consumer messaging.Subscriber
 	hub      *sse.Hub
 	ctx      context.Context
 	cancel   context.CancelFunc
 }
 
-func NewSSEService(consumerConfig *redpanda.RedpandaConsumerConfig) *SSEService {
-	consumer := redpanda.NewRedpandaConsumer(consumerConfig)
+// NewSSEService broadcasts the progress events read by consumer, which must already be connected.
+func NewSSEService(consumer messaging.Subscriber) *SSEService {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &SSEService{
 		consumer: consumer,
@@ -28,7 +26,6 @@ func NewSSEService(consumerConfig *redpanda.RedpandaConsumerConfig) *SSEService
 }
 
 func (s *SSEService) Run() {
-	s.consumer.Connect()
 	go s.hub.Run()
 	go s.consumer.ReadMessage(s.HandleStreamMessage)
 }
@@ -39,11 +36,12 @@ func (s *SSEService) Stop() error {
 	return nil
 }
 
-func (s *SSEService) HandleStreamMessage(msg kafka.Message) (bool, error) {
+func (s *SSEService) HandleStreamMessage(msg messaging.Message) (bool, error) {
 
 	var event sse.ProgressEvent
 	if err := json.Unmarshal(msg.Value, &event); err != nil {
-		return false, err
+		// Commit malformed events, they would otherwise hold back every commit after them
+		return true, err
 	}
 
 	s.hub.BroadcastEvent(event)
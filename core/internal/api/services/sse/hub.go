@@ -11,6 +11,15 @@ type ProgressEvent struct {
 	Status string `json:"status"`
 	Stage string `json:"stage"`
 	Message string `json:"message"`
+	// Progress is the startup percentage of the health_checking stage, when the server logged a known step
+	Progress string `json:"progress,omitempty"`
+	// QueuePosition is the position of a queued build among the builds waiting for a free slot
+	QueuePosition string `json:"queue_position,omitempty"`
+	// Category, Explanation and Logs diagnose a failed startup or a crash: the failure category,
+	// a human explanation and the last lines the server logged, one per line
+	Category string `json:"category,omitempty"`
+	Explanation string `json:"explanation,omitempty"`
+	Logs string `json:"logs,omitempty"`
 }
 
 type Client struct {
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"beelder/internal/api/services/sse"
+	"beelder/pkg/messaging"
+	"beelder/pkg/messaging/memory"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestSSEServiceForwardsWorkerEvents(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields map[string]string
+		want   sse.ProgressEvent
+	}{
+		{
+			name: "queued build",
+			fields: map[string]string{
+				"message":        "Waiting for a free build slot",
+				"status":         "queued",
+				"queue_position": "2",
+				"server_id":      "srv-1",
+			},
+			want: sse.ProgressEvent{ServerID: "srv-1", Status: "queued", Message: "Waiting for a free build slot", QueuePosition: "2"},
+		},
+		{
+			name: "startup progress",
+			fields: map[string]string{
+				"message":   "Preparing the world",
+				"status":    "building",
+				"stage":     "health_checking",
+				"progress":  "60",
+				"server_id": "srv-1",
+			},
+			want: sse.ProgressEvent{ServerID: "srv-1", Status: "building", Stage: "health_checking", Message: "Preparing the world", Progress: "60"},
+		},
+		{
+			name: "failed startup",
+			fields: map[string]string{
+				"error":       "Failed to build server: health check failed",
+				"status":      "error",
+				"stage":       "health_checking",
+				"server_id":   "srv-1",
+				"category":    "eula_not_accepted",
+				"explanation": "The server did not start because the EULA was not accepted.",
+				"logs":        "Loading eula.txt\nYou need to agree to the EULA in order to run the server.",
+			},
+			want: sse.ProgressEvent{
+				ServerID:    "srv-1",
+				Status:      "error",
+				Stage:       "health_checking",
+				Category:    "eula_not_accepted",
+				Explanation: "The server did not start because the EULA was not accepted.",
+				Logs:        "Loading eula.txt\nYou need to agree to the EULA in order to run the server.",
+			},
+		},
+	}
+
+	service := NewSSEService(memory.NewBus().Subscriber("progress", "api"))
+	go service.GetHub().Run()
+	client := sse.NewClient("srv-1")
+	service.GetHub().RegisterClient(client)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := json.Marshal(tt.fields)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if commit, err := service.HandleStreamMessage(messaging.Message{Value: value}); !commit || err != nil {
+				t.Fatalf("HandleStreamMessage() = %v, %v, want the event committed", commit, err)
+			}
+
+			select {
+			case event := <-client.Channel:
+				if event != tt.want {
+					t.Errorf("event = %+v, want %+v", event, tt.want)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("event not broadcast to the client of the server")
+			}
+		})
+	}
+}
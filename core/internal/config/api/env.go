@@ -10,6 +10,11 @@ type ApiConfig struct {
 	ServerProgressTopic string
 	GroupID             string
 	Broker              string
+	RegistryPath        string
+	// ServerTypesDir holds server type definitions added to the built-in ones, optional
+	ServerTypesDir string
+	// PlansFile holds the plan catalog replacing the built-in one, optional
+	PlansFile string
 }
 
 var ApiEnvs = initConfig()
@@ -24,6 +29,9 @@ func initConfig() ApiConfig {
 		ServerProgressTopic: config.GetEnv("SERVER_PROGRESS_TOPIC"),
 		GroupID:             config.GetEnv("GROUP_ID"),
 		Broker:              config.GetEnv("BROKER"),
+		RegistryPath:        config.GetEnvOrDefault("REGISTRY_PATH", "beelder.db"),
+		ServerTypesDir:      config.GetEnvOrDefault("SERVER_TYPES_DIR", ""),
+		PlansFile:           config.GetEnvOrDefault("PLANS_FILE", ""),
 	}
 
 	return config
@@ -18,6 +18,14 @@ func GetEnv(key string) string {
 	return ""
 }
 
+// GetEnvOrDefault returns the value of an optional ENV variable, or defaultValue when it is not set.
+func GetEnvOrDefault(key string, defaultValue string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return defaultValue
+}
+
 func LoadEnv(configPath string) error {
 	// First try loading a .env located in the same directory as this source file.
 	// This is handy during development when working directory may differ.
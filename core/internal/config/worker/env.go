@@ -2,15 +2,32 @@ package config
 
 import (
 	"beelder/internal/config"
+	"beelder/internal/types"
 	"encoding/json"
+	"fmt"
 	"log/slog"
-	"os"
 )
 
 type BuilderConfig struct {
 	MaxConcurrentBuilds int32 `json:"max_concurrent_builds"`
 	MaxAliveServers    	int32 `json:"max_alive_servers"`
+	MaxQueuedBuilds     int32 `json:"max_queued_builds"`
 	BuildTimeout        int32 `json:"timeout_seconds"`
+	VolumePolicy        string `json:"volume_policy"` // "keep" (default) or "purge"
+	StopTimeout         int32 `json:"stop_timeout_seconds"`
+	PortRangeStart      int32 `json:"port_range_start"`
+	PortRangeEnd        int32 `json:"port_range_end"`
+	FailureLogLines     int32 `json:"failure_log_lines"` // Log lines attached to a failed startup
+	MonitorInterval     int32 `json:"monitor_interval_seconds"` // Time between two probes of a live server
+	JVMProfiles         JVMProfilesConfig `json:"jvm_profiles"`
+}
+
+// JVMProfilesConfig selects the JVM flag profile of each server (e.g. "aikar", "zgc" or "minimal").
+// A profile selected for the server type wins over one selected for the plan.
+type JVMProfilesConfig struct {
+	Default     string            `json:"default"`
+	Plans       map[string]string `json:"plans"`        // Keyed by RAM plan, e.g. "12GB"
+	ServerTypes map[string]string `json:"server_types"` // Keyed by server type, e.g. "forge"
 }
 
 type WorkerConfig struct {
@@ -19,36 +36,94 @@ type WorkerConfig struct {
 	ProducerTopic  string
 	GroupID string
 	DockerHost string
+	PublicHost string
+	// ProbeHost is the host the worker reaches the published server ports on, PublicHost by default
+	ProbeHost string
+	// ServerTypesDir holds server type definitions added to the built-in ones, optional
+	ServerTypesDir string
+	// DockerfileTemplatesDir holds Dockerfile templates overriding the built-in one, optional
+	DockerfileTemplatesDir string
+	// PlansFile holds the plan catalog replacing the built-in one, optional
+	PlansFile string
 	BuilderConfig BuilderConfig
 }
 
-var WorkerEnvs = initConfig()
+// WorkerEnvs is the worker configuration, empty until Load or Set is called.
+var WorkerEnvs WorkerConfig
 
-func initConfig() WorkerConfig {
+// Load reads the worker configuration from the environment, and the worker .env file when there is one, into WorkerEnvs.
+// The worker calls it once at startup, before anything reads WorkerEnvs.
+func Load() error {
 	configLogger := slog.Default().With("component", "config")
 	configLogger.Info("Loading worker environment variables")
 	if err := config.LoadEnv("worker"); err != nil {
-		configLogger.Error("Error loading .env file", "error", err)
-		os.Exit(1)
+		return fmt.Errorf("error loading .env file: %w", err)
 	}
 
 	var builderConfig BuilderConfig
 	builderConfigString := config.GetEnv("BUILDER_CONFIG")
-	err := json.Unmarshal([]byte(builderConfigString), &builderConfig); if err != nil {
-		configLogger.Error("Error parsing BUILDER_CONFIG", "error", err)
-		os.Exit(1)
+	if err := json.Unmarshal([]byte(builderConfigString), &builderConfig); err != nil {
+		return fmt.Errorf("error parsing BUILDER_CONFIG: %w", err)
 	}
 
-	config := WorkerConfig{
+	Set(WorkerConfig{
 		Broker:     config.GetEnv("BROKER"),
 		ConsumerTopic: config.GetEnv("CONSUMER_TOPIC"),
 		ProducerTopic:  config.GetEnv("PRODUCER_TOPIC"),
 		GroupID: config.GetEnv("GROUP_ID"),
 		DockerHost: config.GetEnv("DOCKER_HOST"),
+		PublicHost: config.GetEnvOrDefault("PUBLIC_HOST", ""),
+		ProbeHost: config.GetEnvOrDefault("PROBE_HOST", ""),
+		ServerTypesDir: config.GetEnvOrDefault("SERVER_TYPES_DIR", ""),
+		DockerfileTemplatesDir: config.GetEnvOrDefault("DOCKERFILE_TEMPLATES_DIR", ""),
+		PlansFile: config.GetEnvOrDefault("PLANS_FILE", ""),
 		BuilderConfig: builderConfig,
-	}
+	})
 
 	configLogger.Info("Worker environment variables loaded successfully!")
+	return nil
+}
 
-	return config
-}
\ No newline at end of file
+// Set replaces the worker configuration, filling the unset optional values with their defaults.
+// Tests use it to run the builder and the worker without environment variables.
+func Set(workerConfig WorkerConfig) {
+	if workerConfig.PublicHost == "" {
+		workerConfig.PublicHost = "localhost"
+	}
+	if workerConfig.ProbeHost == "" {
+		workerConfig.ProbeHost = workerConfig.PublicHost
+	}
+	workerConfig.BuilderConfig.setDefaults()
+	WorkerEnvs = workerConfig
+}
+
+func (builderConfig *BuilderConfig) setDefaults() {
+	if builderConfig.VolumePolicy == "" {
+		builderConfig.VolumePolicy = types.VolumePolicyKeep
+	}
+
+	if builderConfig.MaxQueuedBuilds <= 0 {
+		builderConfig.MaxQueuedBuilds = 50
+	}
+	if builderConfig.StopTimeout <= 0 {
+		builderConfig.StopTimeout = 30
+	}
+
+	if builderConfig.FailureLogLines <= 0 {
+		builderConfig.FailureLogLines = 50
+	}
+	if builderConfig.MonitorInterval <= 0 {
+		builderConfig.MonitorInterval = 30
+	}
+
+	if builderConfig.JVMProfiles.Default == "" {
+		builderConfig.JVMProfiles.Default = "aikar"
+	}
+
+	if builderConfig.PortRangeStart <= 0 {
+		builderConfig.PortRangeStart = 25565
+	}
+	if builderConfig.PortRangeEnd < builderConfig.PortRangeStart {
+		builderConfig.PortRangeEnd = builderConfig.PortRangeStart + 99
+	}
+}
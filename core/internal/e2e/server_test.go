@@ -0,0 +1,330 @@
+// Package e2e runs the API, the worker and the SSE hub in one process, connected by the in-memory bus,
+// with servers running on the fake container runtime.
+package e2e
+
+import (
+	"beelder/internal/api/handlers"
+	"beelder/internal/api/services"
+	"beelder/internal/api/services/registry"
+	"beelder/internal/api/services/sse"
+	config "beelder/internal/config/worker"
+	"beelder/internal/plans"
+	"beelder/internal/servertypes"
+	"beelder/internal/types"
+	"beelder/internal/worker"
+	"beelder/internal/worker/builder/fakeruntime"
+	"beelder/pkg/messaging/memory"
+	"beelder/pkg/slp/slptest"
+	"beelder/pkg/validation"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	commandsTopic = "server-commands"
+	progressTopic = "server-progress"
+	// serverPort is the first port of the worker range, outside of the ephemeral ports other tests listen on
+	serverPort = 31100
+	// eventTimeout bounds the wait for an event, the worker probes starting servers every 2 seconds
+	eventTimeout = 10 * time.Second
+)
+
+const createServerBody = `{
+	"name": "e2e server",
+	"server_type": "vanilla",
+	"server_version": "1.21.1",
+	"region": "eu-west-1",
+	"player_count": 5,
+	"ram_plan": "2GB",
+	"difficulty": "normal"
+}`
+
+// environment is a running API and worker sharing a bus and a fake runtime.
+type environment struct {
+	baseURL string
+	runtime *fakeruntime.Runtime
+}
+
+// newEnvironment starts the API on a local port and a worker building servers on the fake runtime,
+// in a project root holding a vanilla 1.21.1 jar. Everything is stopped at the end of the test.
+func newEnvironment(t *testing.T, script fakeruntime.Script) *environment {
+	t.Helper()
+
+	root := t.TempDir()
+	jarDir := filepath.Join(root, "assets", "executables", "vanilla")
+	for _, dir := range []string{filepath.Join(root, "core"), jarDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(jarDir, "1.21.1.jar"), []byte("jar"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(root)
+
+	config.Set(config.WorkerConfig{
+		ProbeHost: "127.0.0.1",
+		BuilderConfig: config.BuilderConfig{
+			MaxConcurrentBuilds: 1,
+			MaxAliveServers:     2,
+			BuildTimeout:        10,
+			StopTimeout:         5,
+			PortRangeStart:      serverPort,
+			PortRangeEnd:        serverPort + 9,
+		},
+	})
+
+	serverTypes, err := servertypes.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog, err := plans.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus := memory.NewBus()
+
+	// Worker
+	runtime := fakeruntime.New()
+	runtime.DefaultScript(script)
+	w := worker.New(bus.Publisher(progressTopic), bus.Subscriber(commandsTopic, "workers"), runtime, serverTypes, catalog)
+	workerDone := make(chan error, 1)
+	go func() {
+		workerDone <- w.Start()
+	}()
+	t.Cleanup(func() {
+		w.Stop()
+		if err := <-workerDone; err != nil {
+			t.Errorf("worker stopped with an error: %v", err)
+		}
+	})
+
+	// API, wired like cmd/api
+	store, err := registry.NewStore(filepath.Join(t.TempDir(), "registry.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	validation.SetCatalog(serverTypes, catalog)
+	registryService := services.NewRegistryService(bus.Subscriber(progressTopic, "api-registry"), store)
+	registryService.Run()
+	t.Cleanup(func() { registryService.Stop() })
+	sseService := services.NewSSEService(bus.Subscriber(progressTopic, "api"))
+	sseService.Run()
+	t.Cleanup(func() { sseService.Stop() })
+	serverService := services.NewServerService(bus.Publisher(commandsTopic), registryService, serverTypes, catalog)
+
+	app := fiber.New()
+	v1 := app.Group("/api").Group("/v1")
+	handlers.NewServerHandler(serverService).RegisterRoutes(v1)
+	handlers.NewSSEHandler(sseService).RegisterRoutes(v1)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(listener)
+	t.Cleanup(func() { app.ShutdownWithTimeout(time.Second) })
+
+	return &environment{
+		baseURL: "http://" + listener.Addr().String() + "/api/v1",
+		runtime: runtime,
+	}
+}
+
+// request sends a request to the API and decodes the JSON response into response.
+func (e *environment) request(t *testing.T, method string, path string, body string, wantStatus int, response any) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, e.baseURL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var buf bytes.Buffer
+	buf.ReadFrom(resp.Body)
+	if resp.StatusCode != wantStatus {
+		t.Fatalf("%s %s = %d %s, want %d", method, path, resp.StatusCode, buf.String(), wantStatus)
+	}
+	if response != nil {
+		if err := json.Unmarshal(buf.Bytes(), response); err != nil {
+			t.Fatalf("%s %s returned invalid JSON %s: %v", method, path, buf.String(), err)
+		}
+	}
+}
+
+func (e *environment) createServer(t *testing.T) string {
+	t.Helper()
+	var created struct {
+		ID string `json:"id"`
+	}
+	e.request(t, http.MethodPost, "/server", createServerBody, http.StatusCreated, &created)
+	return created.ID
+}
+
+func (e *environment) getServer(t *testing.T, serverID string) *types.ServerRecord {
+	t.Helper()
+	var response struct {
+		Data *types.ServerRecord `json:"data"`
+	}
+	e.request(t, http.MethodGet, "/server/"+serverID, "", http.StatusOK, &response)
+	return response.Data
+}
+
+// waitForRecord polls the API until the server record has the status.
+func (e *environment) waitForRecord(t *testing.T, serverID string, status string) *types.ServerRecord {
+	t.Helper()
+	deadline := time.Now().Add(eventTimeout)
+	for {
+		record := e.getServer(t, serverID)
+		if record.Status == status {
+			return record
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server status = %q, want %q", record.Status, status)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// subscribe follows the SSE stream of a server until the end of the test.
+func (e *environment) subscribe(t *testing.T, serverID string) <-chan sse.ProgressEvent {
+	t.Helper()
+
+	resp, err := http.Get(e.baseURL + "/sse_server/" + serverID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	events := make(chan sse.ProgressEvent, 100)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		eventType := ""
+		for scanner.Scan() {
+			line := scanner.Text()
+			if value, ok := strings.CutPrefix(line, "event: "); ok {
+				eventType = value
+			}
+			data, ok := strings.CutPrefix(line, "data: ")
+			if !ok || eventType == "connected" {
+				continue
+			}
+			var event sse.ProgressEvent
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				t.Errorf("invalid SSE event %s: %v", data, err)
+				return
+			}
+			events <- event
+		}
+	}()
+	return events
+}
+
+// waitForEvent returns the first event with the status, skipping the others.
+func waitForEvent(t *testing.T, events <-chan sse.ProgressEvent, status string) sse.ProgressEvent {
+	t.Helper()
+	timeout := time.After(eventTimeout)
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatalf("SSE stream closed before a %q event", status)
+			}
+			if event.Status == status {
+				return event
+			}
+		case <-timeout:
+			t.Fatalf("no %q event within %v", status, eventTimeout)
+		}
+	}
+}
+
+func TestCreateAndStopServer(t *testing.T) {
+	// The fake Minecraft server answers pings on the port the worker allocates to the server
+	minecraft, err := slptest.NewServerAt(net.JoinHostPort("127.0.0.1", "31100"), slptest.StatusHandler(`{"version":{"name":"1.21.1","protocol":767},"players":{"max":10,"online":0}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(minecraft.Close)
+
+	env := newEnvironment(t, fakeruntime.Script{
+		Logs: []fakeruntime.LogLine{
+			{After: 0, Text: "[Server thread/INFO]: Starting minecraft server version 1.21.1"},
+			{After: 100 * time.Millisecond, Text: "[Server thread/INFO]: Done (0.1s)! For help, type \"help\""},
+		},
+		StopDelay: 50 * time.Millisecond,
+	})
+
+	serverID := env.createServer(t)
+	if record := env.getServer(t, serverID); record.Config == nil || record.Config.Name != "e2e server" {
+		t.Fatalf("created server not registered: %+v", record)
+	}
+
+	events := env.subscribe(t, serverID)
+	event := waitForEvent(t, events, "running")
+	if event.ServerID != serverID {
+		t.Errorf("running event of server %q, want %q", event.ServerID, serverID)
+	}
+
+	record := env.waitForRecord(t, serverID, "running")
+	if record.Port != serverPort || record.Host != "localhost" || record.ContainerID == "" {
+		t.Errorf("running server record = %+v, want its address and container", record)
+	}
+
+	env.request(t, http.MethodPost, "/server/"+serverID+"/stop", "", http.StatusAccepted, nil)
+	waitForEvent(t, events, "stopped")
+	env.waitForRecord(t, serverID, "stopped")
+
+	if console := env.runtime.Console(record.ContainerID); len(console) == 0 || console[len(console)-1] != "stop" {
+		t.Errorf("console commands = %q, want the server stopped from its console", console)
+	}
+}
+
+func TestCreateServerFailure(t *testing.T) {
+	env := newEnvironment(t, fakeruntime.Script{
+		Logs: []fakeruntime.LogLine{
+			{After: 0, Text: "[ServerMain/INFO]: Loading eula.txt"},
+			{After: 20 * time.Millisecond, Text: "[ServerMain/INFO]: You need to agree to the EULA in order to run the server."},
+		},
+		// Leaves the time to subscribe before the failure
+		ExitAfter: 500 * time.Millisecond,
+	})
+
+	serverID := env.createServer(t)
+	events := env.subscribe(t, serverID)
+	event := waitForEvent(t, events, "error")
+	if event.Stage != "health_checking" || event.Category != "eula_not_accepted" || event.Explanation == "" {
+		t.Errorf("failure event = %+v, want the eula_not_accepted diagnosis", event)
+	}
+	if !strings.Contains(event.Logs, "You need to agree to the EULA") {
+		t.Errorf("failure event logs %q do not contain the EULA line", event.Logs)
+	}
+
+	record := env.waitForRecord(t, serverID, "error")
+	if record.Stage != "health_checking" {
+		t.Errorf("failed stage = %q, want health_checking", record.Stage)
+	}
+	if record.Failure == nil || record.Failure.Category != "eula_not_accepted" {
+		t.Fatalf("failure = %+v, want eula_not_accepted", record.Failure)
+	}
+	if !strings.Contains(record.Failure.Logs, "You need to agree to the EULA") {
+		t.Errorf("failure logs %q do not contain the EULA line", record.Failure.Logs)
+	}
+}
@@ -0,0 +1,221 @@
+// Package plans loads the catalog of the plans servers are created with.
+//
+// The built-in catalog is embedded from plans.yaml. Operators replace it as a whole with a YAML or
+// JSON file with the same fields (PLANS_FILE), shared by the API and the worker.
+package plans
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed plans.yaml
+var builtinCatalog []byte
+
+// ErrUnknownPlan is returned when a plan is not in the catalog.
+var ErrUnknownPlan = errors.New("unknown plan")
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,31}$`)
+
+// Plan is the resources a server gets.
+type Plan struct {
+	Name string `yaml:"name" json:"name"`
+	// MemoryLimitMB is the memory limit of the container.
+	MemoryLimitMB int64 `yaml:"memory_limit_mb" json:"memory_limit_mb"`
+	// HeapMinMB and HeapMaxMB are the -Xms and -Xmx of the JVM, the heap must stay under the memory limit.
+	HeapMinMB int64 `yaml:"heap_min_mb" json:"heap_min_mb"`
+	HeapMaxMB int64 `yaml:"heap_max_mb" json:"heap_max_mb"`
+	// CPUs is the CPU quota of the container in cores, e.g. 1.5.
+	CPUs float64 `yaml:"cpus" json:"cpus"`
+	// DiskQuotaMB is the disk space of the server data. It is advisory, Docker's local volume driver
+	// can not limit the size of a volume.
+	DiskQuotaMB int64 `yaml:"disk_quota_mb" json:"disk_quota_mb"`
+	// MaxPlayers is the number of players the plan is sized for.
+	MaxPlayers int `yaml:"max_players" json:"max_players"`
+	// ServerTypes lists the server types the plan can run, every server type when empty.
+	ServerTypes []string `yaml:"server_types" json:"server_types"`
+	// Regions lists the regions the plan is offered in, every region of the catalog when empty.
+	Regions []string `yaml:"regions" json:"regions"`
+}
+
+// NanoCPUs returns the CPU quota in units of 10^-9 CPUs, as Docker expects it.
+func (p *Plan) NanoCPUs() int64 {
+	return int64(p.CPUs * 1e9)
+}
+
+// AllowsServerType reports whether servers of the type can be created with the plan.
+func (p *Plan) AllowsServerType(serverType string) bool {
+	return len(p.ServerTypes) == 0 || slices.Contains(p.ServerTypes, serverType)
+}
+
+// AvailableIn reports whether the plan is offered in a region of the catalog.
+func (p *Plan) AvailableIn(region string) bool {
+	return len(p.Regions) == 0 || slices.Contains(p.Regions, region)
+}
+
+// validate checks the sizes of a plan.
+func (p *Plan) validate() error {
+	if !namePattern.MatchString(p.Name) {
+		return fmt.Errorf("invalid name %q: must be letters, digits, '-' or '_'", p.Name)
+	}
+	if p.MemoryLimitMB <= 0 {
+		return fmt.Errorf("%s: memory_limit_mb must be positive", p.Name)
+	}
+	if p.HeapMinMB <= 0 || p.HeapMinMB > p.HeapMaxMB {
+		return fmt.Errorf("%s: heap_min_mb must be positive and at most heap_max_mb", p.Name)
+	}
+	if p.HeapMaxMB >= p.MemoryLimitMB {
+		return fmt.Errorf("%s: heap_max_mb must be lower than memory_limit_mb to leave room for the JVM", p.Name)
+	}
+	if p.CPUs <= 0 {
+		return fmt.Errorf("%s: cpus must be positive", p.Name)
+	}
+	if p.DiskQuotaMB < 0 {
+		return fmt.Errorf("%s: disk_quota_mb can not be negative", p.Name)
+	}
+	if p.MaxPlayers <= 0 {
+		return fmt.Errorf("%s: max_players must be positive", p.Name)
+	}
+	return nil
+}
+
+// Catalog holds the plans, from the smallest memory limit to the largest, and the regions they are offered in.
+type Catalog struct {
+	regions []string
+	plans   []Plan
+}
+
+type catalogFile struct {
+	// Regions lists the regions servers can be created in, any region is accepted when empty.
+	Regions []string `yaml:"regions" json:"regions"`
+	Plans   []Plan   `yaml:"plans" json:"plans"`
+}
+
+// Load returns the catalog of the .yaml, .yml or .json file at path, or the built-in catalog when path is empty.
+func Load(path string) (*Catalog, error) {
+	if path == "" {
+		catalog, err := parseCatalog(builtinCatalog, ".yaml")
+		if err != nil {
+			return nil, fmt.Errorf("failed to load built-in plans: %w", err)
+		}
+		return catalog, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plans: %w", err)
+	}
+	catalog, err := parseCatalog(data, strings.ToLower(filepath.Ext(path)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load plans from %s: %w", path, err)
+	}
+	return catalog, nil
+}
+
+// parseCatalog decodes a catalog, unknown fields are rejected to catch typos.
+func parseCatalog(data []byte, ext string) (*Catalog, error) {
+	var file catalogFile
+	switch ext {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&file); err != nil {
+			return nil, err
+		}
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&file); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported file extension %q", ext)
+	}
+
+	if len(file.Plans) == 0 {
+		return nil, errors.New("the catalog has no plans")
+	}
+	seen := make(map[string]bool)
+	for _, plan := range file.Plans {
+		if err := plan.validate(); err != nil {
+			return nil, err
+		}
+		if seen[plan.Name] {
+			return nil, fmt.Errorf("duplicate plan %q", plan.Name)
+		}
+		seen[plan.Name] = true
+
+		for _, region := range plan.Regions {
+			if len(file.Regions) > 0 && !slices.Contains(file.Regions, region) {
+				return nil, fmt.Errorf("%s: region %q is not in the catalog regions %v", plan.Name, region, file.Regions)
+			}
+		}
+	}
+
+	slices.SortStableFunc(file.Plans, func(a, b Plan) int {
+		return int(a.MemoryLimitMB - b.MemoryLimitMB)
+	})
+	return &Catalog{regions: file.Regions, plans: file.Plans}, nil
+}
+
+// CheckServerTypes returns an error when a plan allows a server type missing from known.
+func (c *Catalog) CheckServerTypes(known []string) error {
+	for _, plan := range c.plans {
+		for _, serverType := range plan.ServerTypes {
+			if !slices.Contains(known, serverType) {
+				return fmt.Errorf("plan %s allows unknown server type %q (must be one of %v)", plan.Name, serverType, known)
+			}
+		}
+	}
+	return nil
+}
+
+// Lookup returns a plan by name.
+func (c *Catalog) Lookup(name string) (*Plan, error) {
+	for i := range c.plans {
+		if c.plans[i].Name == name {
+			return &c.plans[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q (must be one of %v)", ErrUnknownPlan, name, c.Names())
+}
+
+// HasRegion reports whether servers can be created in a region.
+func (c *Catalog) HasRegion(region string) bool {
+	return len(c.regions) == 0 || slices.Contains(c.regions, region)
+}
+
+// Regions returns the regions servers can be created in, any region is accepted when empty.
+func (c *Catalog) Regions() []string {
+	return slices.Clone(c.regions)
+}
+
+// Plans returns a copy of the plans, from the smallest memory limit to the largest.
+func (c *Catalog) Plans() []Plan {
+	plans := make([]Plan, len(c.plans))
+	for i, plan := range c.plans {
+		plan.ServerTypes = slices.Clone(plan.ServerTypes)
+		plan.Regions = slices.Clone(plan.Regions)
+		plans[i] = plan
+	}
+	return plans
+}
+
+// Names returns the names of the plans, from the smallest memory limit to the largest.
+func (c *Catalog) Names() []string {
+	names := make([]string, len(c.plans))
+	for i, plan := range c.plans {
+		names[i] = plan.Name
+	}
+	return names
+}
@@ -0,0 +1,307 @@
+// Package servertypes loads the declarative definitions of the server types the builder can deploy.
+//
+// The built-in definitions are embedded from definitions/. Operators can add server types, or replace
+// built-in ones, by dropping YAML or JSON files with the same fields in a directory (SERVER_TYPES_DIR).
+package servertypes
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed definitions/*.yaml
+var builtinDefinitions embed.FS
+
+// ErrUnknownServerType is returned when a server type has no definition.
+var ErrUnknownServerType = errors.New("unknown server type")
+
+var (
+	namePattern     = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+	userPattern     = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+	fileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+)
+
+// VersionPattern restricts server and loader versions to characters valid in both file names and image tags,
+// the builder uses them in jar paths and image tags.
+var VersionPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// Definition declares how a server type is built, started and health checked.
+type Definition struct {
+	Name string `yaml:"name" json:"name"`
+	// Modded servers load mods and need more memory than vanilla or plugin servers with the same players.
+	Modded bool `yaml:"modded" json:"modded"`
+	// BaseImage must be Alpine based, Java is installed with apk.
+	BaseImage string `yaml:"base_image" json:"base_image"`
+	// JavaVersion pins the Java runtime, it is chosen from the Minecraft version when zero.
+	JavaVersion int `yaml:"java_version" json:"java_version"`
+	// VersionScheme tells how the Minecraft version is read from the server version.
+	VersionScheme VersionScheme `yaml:"version_scheme" json:"version_scheme"`
+	// MinMinecraftVersion is the oldest Minecraft version the server type supports (e.g. "1.14"), optional.
+	MinMinecraftVersion string   `yaml:"min_minecraft_version" json:"min_minecraft_version"`
+	Artifact            Artifact `yaml:"artifact" json:"artifact"`
+	// Install are shell commands run in /server after the artifact is copied.
+	// They can use $SERVER_VERSION, $LOADER_VERSION, $MEMORY_MIN, $MEMORY_MAX and $JVM_ARGS,
+	// the full list of JVM arguments including the memory flags.
+	Install []string `yaml:"install" json:"install"`
+	// Launch is the shell command starting the server, with the same variables as Install.
+	Launch string `yaml:"launch" json:"launch"`
+	// LoaderVersion means the mod loader version can be pinned with the loader_version field of the create request.
+	LoaderVersion bool        `yaml:"loader_version" json:"loader_version"`
+	LogPatterns   LogPatterns `yaml:"log_patterns" json:"log_patterns"`
+	// Plugins are jar file names in assets/plugins/<type>/ bundled in the image, optional.
+	Plugins []string `yaml:"plugins" json:"plugins"`
+	// User runs the server as a non-root user with this name, the server runs as root when empty.
+	User string `yaml:"user" json:"user"`
+	// Versions lists the supported versions, any version with an artifact on disk is accepted when empty.
+	Versions []string `yaml:"versions" json:"versions"`
+}
+
+// VersionScheme is the format of the server versions of a server type.
+type VersionScheme string
+
+const (
+	// VersionSchemeMinecraft versions start with the Minecraft version (e.g. "1.21.1", or "1.20.1-47.2.0" for Forge).
+	VersionSchemeMinecraft VersionScheme = "minecraft"
+	// VersionSchemeNeoForge versions drop the leading "1." of the Minecraft version (e.g. "21.1.77" for 1.21.1).
+	VersionSchemeNeoForge VersionScheme = "neoforge"
+	// VersionSchemeNone versions do not tell the Minecraft version, java_version must be set.
+	VersionSchemeNone VersionScheme = "none"
+)
+
+// Artifact describes the jar copied into the image from assets/executables/<type>/.
+type Artifact struct {
+	// Shared means a single installer.jar installs every version, instead of a <version>.jar per version.
+	Shared bool `yaml:"shared" json:"shared"`
+	// CopyTo is the file name of the artifact in /server, "server.jar" by default.
+	CopyTo string `yaml:"copy_to" json:"copy_to"`
+}
+
+// LogPatterns are the log lines looked for while the server starts.
+type LogPatterns struct {
+	// Ready lines mean the server accepts players.
+	Ready []string `yaml:"ready" json:"ready"`
+	// Errors lines mean the server will not finish starting.
+	Errors []string `yaml:"errors" json:"errors"`
+	// Progress lines are the steps of the startup, reported to the user, optional.
+	Progress []ProgressPattern `yaml:"progress" json:"progress"`
+}
+
+// ProgressPattern is a step of the startup recognized in the logs.
+type ProgressPattern struct {
+	// Pattern is a regular expression matched against each log line.
+	Pattern string `yaml:"pattern" json:"pattern"`
+	// Percent is the startup progress when the line is logged.
+	Percent int `yaml:"percent" json:"percent"`
+	// Until maps the percentage captured by the first group of the pattern to the range from Percent to Until, optional.
+	// "Preparing spawn area: 50%" with percent 40 and until 90 is a startup progress of 65.
+	Until   int    `yaml:"until" json:"until"`
+	Message string `yaml:"message" json:"message"`
+
+	regexp *regexp.Regexp
+}
+
+// Match returns the startup progress of a log line.
+func (p *ProgressPattern) Match(line string) (int, bool) {
+	match := p.regexp.FindStringSubmatch(line)
+	if match == nil {
+		return 0, false
+	}
+	if p.Until == 0 || len(match) < 2 {
+		return p.Percent, true
+	}
+	captured, err := strconv.Atoi(match[1])
+	if err != nil {
+		return p.Percent, true
+	}
+	captured = min(max(captured, 0), 100)
+	return p.Percent + captured*(p.Until-p.Percent)/100, true
+}
+
+// compile checks a progress pattern and compiles its regular expression.
+func (p *ProgressPattern) compile() error {
+	re, err := regexp.Compile(p.Pattern)
+	if err != nil {
+		return fmt.Errorf("invalid progress pattern %q: %w", p.Pattern, err)
+	}
+	if p.Percent < 0 || p.Percent > 100 || (p.Until != 0 && (p.Until < p.Percent || p.Until > 100)) {
+		return fmt.Errorf("progress pattern %q: percent and until must be between 0 and 100, until above percent", p.Pattern)
+	}
+	if p.Until != 0 && re.NumSubexp() == 0 {
+		return fmt.Errorf("progress pattern %q: until needs a group capturing the percentage", p.Pattern)
+	}
+	if strings.TrimSpace(p.Message) == "" {
+		return fmt.Errorf("progress pattern %q: message is required", p.Pattern)
+	}
+	p.regexp = re
+	return nil
+}
+
+// SupportsVersion reports whether the definition accepts the server version.
+func (d *Definition) SupportsVersion(version string) bool {
+	return len(d.Versions) == 0 || slices.Contains(d.Versions, version)
+}
+
+// setDefaults fills the optional fields.
+func (d *Definition) setDefaults() {
+	if d.BaseImage == "" {
+		d.BaseImage = "alpine:latest"
+	}
+	if d.VersionScheme == "" {
+		d.VersionScheme = VersionSchemeMinecraft
+	}
+	if d.Artifact.CopyTo == "" {
+		d.Artifact.CopyTo = "server.jar"
+	}
+}
+
+// validate checks a definition once its defaults are set.
+func (d *Definition) validate() error {
+	if !namePattern.MatchString(d.Name) {
+		return fmt.Errorf("invalid name %q: must be lowercase letters, digits, '-' or '_'", d.Name)
+	}
+	switch d.VersionScheme {
+	case VersionSchemeMinecraft, VersionSchemeNeoForge:
+	case VersionSchemeNone:
+		if d.JavaVersion <= 0 {
+			return fmt.Errorf("%s: java_version is required with the %q version scheme", d.Name, d.VersionScheme)
+		}
+	default:
+		return fmt.Errorf("%s: invalid version_scheme %q", d.Name, d.VersionScheme)
+	}
+	if d.JavaVersion < 0 {
+		return fmt.Errorf("%s: invalid java_version %d", d.Name, d.JavaVersion)
+	}
+	if !fileNamePattern.MatchString(d.Artifact.CopyTo) {
+		return fmt.Errorf("%s: invalid artifact copy_to %q", d.Name, d.Artifact.CopyTo)
+	}
+	for _, plugin := range d.Plugins {
+		if !fileNamePattern.MatchString(plugin) {
+			return fmt.Errorf("%s: invalid plugin %q", d.Name, plugin)
+		}
+	}
+	if d.User != "" && (!userPattern.MatchString(d.User) || d.User == "root") {
+		return fmt.Errorf("%s: invalid user %q", d.Name, d.User)
+	}
+	if strings.TrimSpace(d.Launch) == "" {
+		return fmt.Errorf("%s: launch is required", d.Name)
+	}
+	if len(d.LogPatterns.Ready) == 0 {
+		return fmt.Errorf("%s: at least one ready log pattern is required", d.Name)
+	}
+	for i := range d.LogPatterns.Progress {
+		if err := d.LogPatterns.Progress[i].compile(); err != nil {
+			return fmt.Errorf("%s: %w", d.Name, err)
+		}
+	}
+	return nil
+}
+
+// Registry holds the definitions of the supported server types.
+type Registry struct {
+	definitions map[string]*Definition
+	names       []string
+}
+
+// Load returns the built-in definitions, extended and overridden by the definitions found in dir.
+// An empty dir loads the built-in definitions only.
+func Load(dir string) (*Registry, error) {
+	registry := &Registry{definitions: make(map[string]*Definition)}
+
+	if err := registry.loadFS(builtinDefinitions, "definitions"); err != nil {
+		return nil, fmt.Errorf("failed to load built-in server types: %w", err)
+	}
+
+	if dir != "" {
+		if err := registry.loadFS(os.DirFS(dir), "."); err != nil {
+			return nil, fmt.Errorf("failed to load server types from %s: %w", dir, err)
+		}
+	}
+
+	slices.Sort(registry.names)
+	return registry, nil
+}
+
+// loadFS adds every .yaml, .yml and .json definition of a directory, in file name order.
+func (r *Registry) loadFS(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".json") {
+			continue
+		}
+
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+
+		definition, err := parseDefinition(data, ext)
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		r.add(definition)
+	}
+	return nil
+}
+
+// parseDefinition decodes a definition, unknown fields are rejected to catch typos.
+func parseDefinition(data []byte, ext string) (*Definition, error) {
+	var definition Definition
+	if ext == ".json" {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&definition); err != nil {
+			return nil, err
+		}
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&definition); err != nil {
+			return nil, err
+		}
+	}
+
+	definition.setDefaults()
+	if err := definition.validate(); err != nil {
+		return nil, err
+	}
+	return &definition, nil
+}
+
+func (r *Registry) add(definition *Definition) {
+	if _, ok := r.definitions[definition.Name]; !ok {
+		r.names = append(r.names, definition.Name)
+	}
+	r.definitions[definition.Name] = definition
+}
+
+// Lookup returns the definition of a server type.
+func (r *Registry) Lookup(name string) (*Definition, error) {
+	definition, ok := r.definitions[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q (must be one of %v)", ErrUnknownServerType, name, r.names)
+	}
+	return definition, nil
+}
+
+// Names returns the sorted names of the supported server types.
+func (r *Registry) Names() []string {
+	return slices.Clone(r.names)
+}
@@ -0,0 +1,63 @@
+package servertypes
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// MinecraftVersion is a "1.<minor>.<patch>" Minecraft release.
+type MinecraftVersion struct {
+	Minor int
+	Patch int
+}
+
+func (v MinecraftVersion) String() string {
+	return fmt.Sprintf("1.%d.%d", v.Minor, v.Patch)
+}
+
+// Before reports whether v is an older release than other.
+func (v MinecraftVersion) Before(other MinecraftVersion) bool {
+	return v.Minor < other.Minor || (v.Minor == other.Minor && v.Patch < other.Patch)
+}
+
+var (
+	// minecraftVersionPattern matches the Minecraft version at the start of a server version, "1.20.1-47.2.0" is 1.20.1
+	minecraftVersionPattern = regexp.MustCompile(`^1\.(\d+)(?:\.(\d+))?(?:$|[^.\d])`)
+	// neoForgeVersionPattern matches NeoForge versions, "21.1.77" is Minecraft 1.21.1
+	neoForgeVersionPattern = regexp.MustCompile(`^(\d+)\.(\d+)\.\d+`)
+)
+
+// ParseMinecraftVersion reads the Minecraft version of a server version with the version scheme of its server type.
+func ParseMinecraftVersion(scheme VersionScheme, serverVersion string) (MinecraftVersion, bool) {
+	pattern := minecraftVersionPattern
+	if scheme == VersionSchemeNeoForge {
+		pattern = neoForgeVersionPattern
+	}
+
+	match := pattern.FindStringSubmatch(serverVersion)
+	if match == nil {
+		return MinecraftVersion{}, false
+	}
+	minor, _ := strconv.Atoi(match[1])
+	patch, _ := strconv.Atoi(match[2]) // A missing patch is the .0 release
+	return MinecraftVersion{Minor: minor, Patch: patch}, true
+}
+
+// MinecraftVersion returns the Minecraft version of a server version of the server type.
+// It returns false when the version scheme does not tell the Minecraft version or the version can not be read.
+func (d *Definition) MinecraftVersion(serverVersion string) (MinecraftVersion, bool) {
+	if d.VersionScheme == VersionSchemeNone {
+		return MinecraftVersion{}, false
+	}
+	return ParseMinecraftVersion(d.VersionScheme, serverVersion)
+}
+
+// SupportsMinecraftVersion reports whether the Minecraft version is not older than the oldest one supported by the server type.
+func (d *Definition) SupportsMinecraftVersion(version MinecraftVersion) bool {
+	if d.MinMinecraftVersion == "" {
+		return true
+	}
+	minVersion, ok := ParseMinecraftVersion(VersionSchemeMinecraft, d.MinMinecraftVersion)
+	return !ok || !version.Before(minVersion)
+}
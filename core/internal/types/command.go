@@ -0,0 +1,25 @@
+package types
+
+// Command keys published on the server commands topic.
+const (
+	CommandCreateServer  = "server.create"
+	CommandStopServer    = "server.stop"
+	CommandStartServer   = "server.start"
+	CommandRestartServer = "server.restart"
+	CommandDeleteServer  = "server.delete"
+)
+
+// ServerCommand is the envelope sent by the API to the worker on the commands topic.
+// ServerID is issued by the API and must be used by the worker for every event it emits,
+// so clients can follow a server from the initial request until it is running.
+type ServerCommand struct {
+	ServerID      string              `json:"server_id"`
+	CorrelationID string              `json:"correlation_id"`
+	Config        *CreateServerConfig `json:"config,omitempty"`
+	// VolumePolicy overrides the server's volume policy on delete.
+	VolumePolicy string `json:"volume_policy,omitempty"`
+}
+
+type DeleteServerParams struct {
+	VolumePolicy string `query:"volume_policy" validate:"omitempty,oneof=keep purge"`
+}
@@ -1,26 +1,43 @@
 package types
 
+import "time"
+
 type CreateServerData struct {
-	ContainerID  string
-	ServerID     string
-	ServerConfig *CreateServerConfig
-	ImageName    string
+	ContainerID   string
+	ServerID      string
+	CorrelationID string
+	ServerConfig  *CreateServerConfig
+	ImageName     string
+	Port          int32
 }
 type CreateServerConfig struct {
 	Name          string `json:"name" validate:"required,min=3,max=64"`
-	ServerVersion string `json:"server_version" validate:"required"`
-	ServerType    string `json:"server_type" validate:"required"`
-	Region        string `json:"region" validate:"required"`
+	ServerVersion string `json:"server_version" validate:"required,mcversion=ServerType"`
+	ServerType    string `json:"server_type" validate:"required,servertype"`
+	// LoaderVersion pins the mod loader version of Fabric and Quilt servers, the latest stable loader is used when empty.
+	LoaderVersion string `json:"loader_version,omitempty" validate:"omitempty,max=64,loaderversion=ServerType"`
+	Region        string `json:"region" validate:"required,region=RamPlan"`
 	PlayerCount   int    `json:"player_count" validate:"required,min=1,max=100"`
-	RamPlan       string `json:"ram_plan" validate:"required"`
+	RamPlan       string `json:"ram_plan" validate:"required,ramplan=ServerType"`
 	Difficulty    string `json:"difficulty" validate:"required,oneof=peaceful easy normal hard hardcore"`
 	OnlineMode    bool   `json:"online_mode"`
+	VolumePolicy  string `json:"volume_policy" validate:"omitempty,oneof=keep purge"`
 }
 
+// Volume policies decide what happens to a server's world volumes when it is destroyed.
+const (
+	VolumePolicyKeep  = "keep"
+	VolumePolicyPurge = "purge"
+)
+
 type RecommendationServerParams struct {
 	PlayerCount int    `query:"player_count" validate:"required,min=1,max=100"`
-	ServerType  string `query:"server_type" validate:"required"`
-	Region      string `query:"region" validate:"required"`
+	ServerType  string `query:"server_type" validate:"required,servertype"`
+	Region      string `query:"region" validate:"required,region"`
+	// ServerVersion sizes the plans for the worlds of its Minecraft version, the latest worlds are assumed when empty.
+	ServerVersion string `query:"server_version" validate:"omitempty,max=64,mcversion=ServerType"`
+	// ModCount is the expected number of mods, or plugins for plugin servers, optional.
+	ModCount int `query:"mod_count" validate:"min=0,max=1000"`
 }
 
 type MemorySettings struct {
@@ -28,6 +45,51 @@ type MemorySettings struct {
 	Max string
 }
 
+// RecommendationResponse ranks the plans of the catalog for a server, best first.
 type RecommendationResponse struct {
-	Recommendation string `json:"recommendation"`
+	// Recommendation is the name of the best plan, empty when no plan can run the server.
+	Recommendation string               `json:"recommendation"`
+	Plans          []PlanRecommendation `json:"plans"`
+}
+
+// PlanRecommendation is how well a plan fits a server.
+type PlanRecommendation struct {
+	Plan string `json:"plan"`
+	// Score is the fit of the plan from 0 to 100, 0 when the plan can not run the server.
+	Score int `json:"score"`
+	// Fits means the plan has the memory and player capacity the server needs.
+	Fits    bool     `json:"fits"`
+	Reasons []string `json:"reasons"`
+}
+
+// ServerRecord is the API's view of a server, built from the create request and the progress events.
+type ServerRecord struct {
+	ID          string              `json:"id"`
+	Status      string              `json:"status"`
+	Stage       string              `json:"stage,omitempty"`
+	Message     string              `json:"message,omitempty"`
+	Error       string              `json:"error,omitempty"`
+	Host        string              `json:"host,omitempty"`
+	Port        int                 `json:"port,omitempty"`
+	ContainerID string              `json:"container_id,omitempty"`
+	Failure     *ServerFailure      `json:"failure,omitempty"`
+	Config      *CreateServerConfig `json:"config,omitempty"`
+	CreatedAt   time.Time           `json:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at"`
+	// LastEventAt is the timestamp of the last applied progress event, used to drop out of order events.
+	LastEventAt time.Time `json:"last_event_at"`
+}
+
+// ServerFailure is the cause of the last failed startup of a server, found in the server logs by the worker.
+// It is kept on the record until the server runs again.
+type ServerFailure struct {
+	Category    string `json:"category"`
+	Explanation string `json:"explanation"`
+	// Logs are the last lines the server logged, one per line.
+	Logs string `json:"logs,omitempty"`
+}
+
+type ListServersParams struct {
+	Status     string `query:"status"`
+	ServerType string `query:"server_type"`
 }
@@ -3,8 +3,10 @@ package builder
 import (
 	"archive/tar"
 	config "beelder/internal/config/worker"
+	"beelder/internal/plans"
+	"beelder/internal/servertypes"
 	"beelder/internal/types"
-	"beelder/pkg/messaging/redpanda"
+	"beelder/pkg/messaging"
 	"bytes"
 	"context"
 	"fmt"
@@ -12,25 +14,21 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
-	"strings"
+	"strconv"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/docker/docker/api/types/build"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/network"
-	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/docker/go-connections/nat"
 )
 
-const (
-	initialPort = 25565
-)
-
 // validateServerConfig checks if the server configuration is valid before building.
+// The definition is the one of the requested server type and the plan the one of the requested RAM plan.
 // Returns an error if any required fields are missing or invalid.
-func validateServerConfig(config *types.CreateServerConfig) error {
+func validateServerConfig(config *types.CreateServerConfig, definition *servertypes.Definition, plan *plans.Plan) error {
 	if config.Name == "" {
 		return fmt.Errorf("server name cannot be empty")
 	}
@@ -39,52 +37,58 @@ func validateServerConfig(config *types.CreateServerConfig) error {
 		return fmt.Errorf("server type cannot be empty")
 	}
 
-	validTypes := []string{"paper", "forge", "fabric"}
-	if !contains(validTypes, config.ServerType) {
-		return fmt.Errorf("invalid server type: %s (must be one of %v)", config.ServerType, validTypes)
+	if !definition.SupportsVersion(config.ServerVersion) {
+		return fmt.Errorf("unsupported %s version: %s (must be one of %v)", config.ServerType, config.ServerVersion, definition.Versions)
 	}
 
-	if config.RamPlan == "" {
-		return fmt.Errorf("ram plan cannot be empty")
+	if !plan.AllowsServerType(config.ServerType) {
+		return fmt.Errorf("ram plan %s does not allow %s servers (must be one of %v)", plan.Name, config.ServerType, plan.ServerTypes)
 	}
 
-	validPlans := []string{"2GB", "4GB", "6GB", "8GB", "12GB"}
-	if !contains(validPlans, config.RamPlan) {
-		return fmt.Errorf("invalid ram plan: %s (must be one of %v)", config.RamPlan, validPlans)
+	if config.LoaderVersion != "" {
+		if !definition.LoaderVersion {
+			return fmt.Errorf("loader version is not supported for %s servers", config.ServerType)
+		}
+		if !servertypes.VersionPattern.MatchString(config.LoaderVersion) {
+			return fmt.Errorf("invalid loader version: %q", config.LoaderVersion)
+		}
 	}
 
 	return nil
 }
 
-// contains checks if a string slice contains a specific item.
-func contains(slice []string, item string) bool {
-	for _, s := range slice {
-		if strings.Contains(s, item) {
-			return true
-		}
-	}
-	return false
-}
-
 // Builder handles the creation and deployment of Minecraft servers using Docker.
 // It manages the entire lifecycle from Dockerfile generation to container health checks.
 type Builder struct{
 	healthChecker *HealthChecker
-	producer *redpanda.RedpandaProducer
-	portCounter atomic.Int32
+	serverTypes *servertypes.Registry
+	plans *plans.Catalog
+	strategies StrategyFactory
+	producer messaging.Publisher
+	runtime ContainerRuntime
+	ports *PortAllocator
 	logger *slog.Logger
 	imageBuildLocks sync.Map
 }
 
 // NewBuilder initializes and returns a new Builder instance.
-func NewBuilder(producer *redpanda.RedpandaProducer) *Builder {
-	healthChecker := NewHealthChecker()
+// The runtime is shared with the health checker, serverTypes holds the definitions of the server types it can build
+// and plans the resources of the plans servers are created with.
+func NewBuilder(producer messaging.Publisher, runtime ContainerRuntime, serverTypes *servertypes.Registry, plans *plans.Catalog) *Builder {
+	healthChecker := NewHealthChecker(runtime)
 	builder := &Builder{
+		serverTypes: serverTypes,
+		plans: plans,
+		strategies: NewDefaultStrategyFactory(serverTypes, plans),
 		producer: producer,
+		runtime: runtime,
 		healthChecker: healthChecker,
+		ports: NewPortAllocator(
+			config.WorkerEnvs.BuilderConfig.PortRangeStart,
+			config.WorkerEnvs.BuilderConfig.PortRangeEnd,
+		),
 		logger:  slog.Default().With("component", "builder"),
 	}
-	builder.portCounter.Store(initialPort)
 	return builder
 }
 
@@ -95,23 +99,61 @@ func NewBuilder(producer *redpanda.RedpandaProducer) *Builder {
 // Returns an error if any step fails.
 func (b *Builder) BuildServer(ctx context.Context, serverData *types.CreateServerData) (error, string) {
     // Validate configuration before starting build
-    if err := validateServerConfig(serverData.ServerConfig); err != nil {
+	// Unknown server types fail here instead of being built with a generic strategy
+	definition, err := b.serverTypes.Lookup(serverData.ServerConfig.ServerType)
+	if err != nil {
+		return fmt.Errorf("invalid server configuration: %w", err), "validating_configuration"
+	}
+	plan, err := b.plans.Lookup(serverData.ServerConfig.RamPlan)
+	if err != nil {
+		return fmt.Errorf("invalid server configuration: %w", err), "validating_configuration"
+	}
+    if err := validateServerConfig(serverData.ServerConfig, definition, plan); err != nil {
         return fmt.Errorf("invalid server configuration: %w", err), "validating_configuration"
     }
 
-    imageName := fmt.Sprintf("ms-%s-%s:latest", serverData.ServerConfig.ServerType, serverData.ServerConfig.RamPlan)
+	// Fail before building anything if the requested version is not on disk
+	if _, err := resolveServerJar(definition, serverData.ServerConfig.ServerVersion); err != nil {
+		return fmt.Errorf("server version not available: %w", err), "resolving_server_version"
+	}
+
+	// Refuse versions no Java runtime can run before building anything
+	javaRuntime, err := resolveJavaRuntime(definition, serverData.ServerConfig.ServerVersion)
+	if err != nil {
+		return err, "resolving_java_runtime"
+	}
+
+    // Strategy now handles everything including memory
+    buildStrategy := NewDeclarativeBuildStrategy(definition, plan, serverData.ServerConfig, javaRuntime)
+
+	imageName := imageNameFor(
+		serverData.ServerConfig.ServerType,
+		serverData.ServerConfig.RamPlan,
+		serverData.ServerConfig.ServerVersion,
+		serverData.ServerConfig.LoaderVersion,
+		javaRuntime,
+		buildStrategy.GetResourceSettings().JVMProfile,
+	)
 	serverData.ImageName = imageName
 	builderLogger := b.logger.With(
 		"action", "build_server",
 		"server_id", serverData.ServerID,
+		"correlation_id", serverData.CorrelationID,
 		"server_type", serverData.ServerConfig.ServerType,
 		"ram_plan", serverData.ServerConfig.RamPlan,
+		"server_version", serverData.ServerConfig.ServerVersion,
+		"java_version", javaRuntime.Version,
 		"image", imageName,
 	)
-    // Strategy now handles everything including memory
-    strategyFactory := &DefaultStrategyFactory{}
-    buildStrategy := strategyFactory.GetStrategy(serverData.ServerConfig)
-    dockerfile := buildStrategy.GenerateDockerfile(serverData.ServerConfig)
+	dockerfileSpec := buildStrategy.GetDockerfileSpec(serverData.ServerConfig)
+	dockerfileTemplate, err := loadDockerfileTemplate(config.WorkerEnvs.DockerfileTemplatesDir, definition.Name)
+	if err != nil {
+		return err, "generating_dockerfile"
+	}
+	dockerfile, err := renderDockerfile(dockerfileTemplate, dockerfileSpec)
+	if err != nil {
+		return err, "generating_dockerfile"
+	}
 
 	b.producer.SendJsonMessage(
 		"server.build.building",
@@ -122,21 +164,17 @@ func (b *Builder) BuildServer(ctx context.Context, serverData *types.CreateServe
 		},
 	)
 
-    err := b.buildImageFromDockerfile(ctx, dockerfile, serverData)
+    err = b.buildImageFromDockerfile(ctx, dockerfile, dockerfileSpec.ContextFiles(), serverData)
 
 	if err != nil {
 		return err, "building_image"
 	}
 
-	cli, err := client.NewClientWithOpts(
-		client.WithHost(config.WorkerEnvs.DockerHost),
-	)
+	port, err := b.ports.Allocate(serverData.ServerID)
 	if err != nil {
-		return fmt.Errorf("failed to connect to new client: %w", err), "connecting_docker_client"
+		return err, "allocating_port"
 	}
-	defer cli.Close()
-
-	port := b.portCounter.Add(1) - 1
+	serverData.Port = port
 	// Create container with restart policy
 	builderLogger.Info("Creating container...")
 	b.producer.SendJsonMessage(
@@ -148,13 +186,22 @@ func (b *Builder) BuildServer(ctx context.Context, serverData *types.CreateServe
 			"server_id": serverData.ServerID,
 		},
 	)
-	resp, err := cli.ContainerCreate(
+	mounts, err := b.createServerVolumes(ctx, serverData.ServerID)
+	if err != nil {
+		b.ports.Release(serverData.ServerID)
+		return err, "creating_volumes"
+	}
+
+	resp, err := b.runtime.ContainerCreate(
 		ctx,
 		&container.Config{
 			Image: imageName,
 			ExposedPorts: nat.PortSet{
 				"25565/tcp": {},
 			},
+			Labels: serverLabels(serverData),
+			// Keep stdin open so console commands such as "stop" can be sent to the server
+			OpenStdin: true,
 		},
 		&container.HostConfig{
 			PortBindings: nat.PortMap{
@@ -165,6 +212,7 @@ func (b *Builder) BuildServer(ctx context.Context, serverData *types.CreateServe
 					},
 				},
 			},
+			Mounts: mounts,
 			RestartPolicy: container.RestartPolicy{
 				Name: "unless-stopped",
 			},
@@ -178,6 +226,10 @@ func (b *Builder) BuildServer(ctx context.Context, serverData *types.CreateServe
 		fmt.Sprintf("ms-%s-%s-%s", serverData.ServerConfig.ServerType, serverData.ServerConfig.RamPlan, serverData.ServerID),
 	)
 	if err != nil {
+		if removeErr := b.removeServerVolumes(ctx, serverData.ServerID); removeErr != nil {
+			builderLogger.Error("failed to remove volumes after container creation error", "error", removeErr)
+		}
+		b.ports.Release(serverData.ServerID)
 		return fmt.Errorf("failed to create container: %w", err), "creating_container"
 	}
 
@@ -185,6 +237,14 @@ func (b *Builder) BuildServer(ctx context.Context, serverData *types.CreateServe
 
 	builderLogger.Info("Container created", "ID", resp.ID)
 
+	// Write server.properties before the first start so the server never boots with vanilla defaults
+	if err := b.copyServerProperties(ctx, resp.ID, serverData.ServerConfig); err != nil {
+		if removeErr := b.DestroyServer(ctx, serverData.ServerID, resp.ID, true); removeErr != nil {
+			builderLogger.Error("failed to remove container after configuration error", "error", removeErr)
+		}
+		return err, "configuring_server"
+	}
+
 	// Start container
 	b.producer.SendJsonMessage(
 		"server.build.building",
@@ -195,7 +255,11 @@ func (b *Builder) BuildServer(ctx context.Context, serverData *types.CreateServe
 			"server_id": serverData.ServerID,
 		},
 	)
-	if err := cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+	startedAt := time.Now()
+	if err := b.runtime.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		if removeErr := b.DestroyServer(ctx, serverData.ServerID, resp.ID, true); removeErr != nil {
+			builderLogger.Error("failed to remove container after start error", "error", removeErr)
+		}
 		return fmt.Errorf("failed to start container: %w", err), "starting_container"
 	}
 	builderLogger.Info("Minecraft server started in background", "ID", resp.ID)
@@ -216,10 +280,25 @@ func (b *Builder) BuildServer(ctx context.Context, serverData *types.CreateServe
 		},
 	)
 
-	if err := b.healthChecker.waitForServerReady(resp.ID, serverData); err != nil {
+	// The startup steps logged by the server move the progress of the health_checking stage
+	reportProgress := func(percent int, message string) {
+		b.producer.SendJsonMessage(
+			"server.build.building",
+			map[string]string{
+				"message": message,
+				"status": "building",
+				"stage": "health_checking",
+				"progress": strconv.Itoa(percent),
+				"server_id": serverData.ServerID,
+			},
+		)
+	}
+
+	if err := b.healthChecker.waitForServerReady(resp.ID, serverData, startedAt, buildStrategy.GetLogPatterns(), reportProgress); err != nil {
 		builderLogger.Error("health check failed, rolling back", "error", err)
 
-		if removeErr := b.DestroyServer(ctx, serverData.ContainerID); removeErr != nil {
+		// A server that never became ready has no data worth keeping
+		if removeErr := b.DestroyServer(ctx, serverData.ServerID, serverData.ContainerID, true); removeErr != nil {
 			return fmt.Errorf("health check failed and rollback failed: health_error=%w, remove_error=%v", err, removeErr), "health_checking"
 		}
 
@@ -233,34 +312,61 @@ func (b *Builder) BuildServer(ctx context.Context, serverData *types.CreateServe
 
 // DestroyServer stops and removes a Docker container by its ID.
 // It forcefully removes the container if it's running.
+// When purgeData is true the server's named volumes are removed as well,
+// otherwise they are kept so the world can be restored later.
 // Returns an error if the removal fails.
-func (b *Builder) DestroyServer(ctx context.Context, containerID string) error {
+func (b *Builder) DestroyServer(ctx context.Context, serverID string, containerID string, purgeData bool) error {
 	builderLogger := b.logger.With(
 		"action", "destroy_server",
+		"server_id", serverID,
 		"container_id", containerID,
+		"purge_data", purgeData,
 	)
 	builderLogger.Info("Destroying server...")
-    cli, err := client.NewClientWithOpts(
-        client.WithHost(config.WorkerEnvs.DockerHost),
-    )
-    if err != nil {
-		builderLogger.Error("Failed to connect to Docker", "error", err)
-        return fmt.Errorf("failed to connect to Docker: %w", err)
-    }
-    defer cli.Close()
-
-    if err := cli.ContainerRemove(ctx, containerID, container.RemoveOptions{
+    if err := b.runtime.ContainerRemove(ctx, containerID, container.RemoveOptions{
         Force: true,
     }); err != nil {
 		builderLogger.Error("Failed to remove container", "error", err)
         return fmt.Errorf("failed to remove container %s: %w", containerID[:12], err)
     }
+	b.ports.Release(serverID)
+
+	if !purgeData {
+		return nil
+	}
+
+	if err := b.removeServerVolumes(ctx, serverID); err != nil {
+		builderLogger.Error("Failed to remove server volumes", "error", err)
+		return err
+	}
 
     return nil
 }
 
+// copyServerProperties renders server.properties from the server config and copies it into the container.
+func (b *Builder) copyServerProperties(ctx context.Context, containerID string, serverConfig *types.CreateServerConfig) error {
+	properties := NewServerProperties(serverConfig).Render()
+
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	if err := addTarFile(tw, serverPropertiesFile, []byte(properties)); err != nil {
+		return fmt.Errorf("failed to add server.properties to tar: %w", err)
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to close server.properties tar: %w", err)
+	}
+
+	// CopyUIDGID gives the file to the user of the image, so servers running as a non-root user can rewrite it
+	if err := b.runtime.CopyToContainer(ctx, containerID, ServerPropertiesPath, buf, container.CopyToContainerOptions{CopyUIDGID: true}); err != nil {
+		return fmt.Errorf("failed to copy server.properties to container: %w", err)
+	}
+	return nil
+}
+
 // buildImageFromDockerfile builds a Docker image from Dockerfile content (string) with the specified image name.
-func (b *Builder) buildImageFromDockerfile(ctx context.Context, dockerfileContent string, serverData *types.CreateServerData) error {
+// Images are cached by name and labeled with the hash of their Dockerfile, an existing image is rebuilt
+// when the Dockerfile rendered for it changes, e.g. after a template or server type definition change.
+func (b *Builder) buildImageFromDockerfile(ctx context.Context, dockerfileContent string, contextFiles []string, serverData *types.CreateServerData) error {
 	builderLogger := b.logger.With(
 		"server_id", serverData.ServerID,
 		"server_type", serverData.ServerConfig.ServerType,
@@ -274,25 +380,21 @@ func (b *Builder) buildImageFromDockerfile(ctx context.Context, dockerfileConten
 	imageLock.Lock()
 	defer imageLock.Unlock()
 
-	cli, err := client.NewClientWithOpts(
-		client.WithHost(config.WorkerEnvs.DockerHost),
-	)
-	if err != nil {
-		return fmt.Errorf("failed to connect to new client: %w", err)
-	}
-	defer cli.Close()
-
 	// Check if image already exists
-	_, err = cli.ImageInspect(ctx, serverData.ImageName)
-	if err == nil {
+	hash := dockerfileHash(dockerfileContent)
+	existing, err := b.runtime.ImageInspect(ctx, serverData.ImageName)
+	switch {
+	case err != nil:
+		builderLogger.Info("Image not found, building...")
+	case existing.Config != nil && existing.Config.Labels[dockerfileHashLabel] == hash:
 		builderLogger.Info("Image already exists, skipping build")
 		return nil
+	default:
+		builderLogger.Info("Image built from another Dockerfile, rebuilding...")
 	}
 
-	builderLogger.Info("Image not found, building...")
-
 	// Create build context
-	buildContext, err := createBuildContext(dockerfileContent, serverData.ServerConfig.ServerType)
+	buildContext, err := createBuildContext(dockerfileContent, contextFiles)
 	if err != nil {
 		return err
 	}
@@ -302,25 +404,26 @@ func (b *Builder) buildImageFromDockerfile(ctx context.Context, dockerfileConten
 		Tags:       []string{serverData.ImageName},
 		Dockerfile: "Dockerfile",
 		Remove:     true,
+		Labels:     map[string]string{dockerfileHashLabel: hash},
 	}
 
-	buildResp, err := cli.ImageBuild(ctx, buildContext, buildOptions)
+	buildResp, err := b.runtime.ImageBuild(ctx, buildContext, buildOptions)
 	if err != nil {
 		return fmt.Errorf("failed to build image: %w", err)
 	}
 	defer buildResp.Body.Close()
 
-	// Optionally, print build output
-	_, err = io.Copy(os.Stdout, buildResp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read build output: %w", err)
+	// Print build output, failed build steps are only reported in this stream
+	if err := jsonmessage.DisplayJSONMessagesStream(buildResp.Body, os.Stdout, os.Stdout.Fd(), false, nil); err != nil {
+		return fmt.Errorf("failed to build image: %w", err)
 	}
 
 	return nil
 }
 
-// createBuildContext creates a tar archive in memory with the Dockerfile and the server jar
-func createBuildContext(dockerfileContent string, serverType string) (io.Reader, error) {
+// createBuildContext creates a tar archive in memory with the Dockerfile and the files it copies.
+// The file paths are relative to the project root and are kept as-is inside the build context.
+func createBuildContext(dockerfileContent string, files []string) (io.Reader, error) {
 	buf := new(bytes.Buffer)
 	tw := tar.NewWriter(buf)
 	defer tw.Close()
@@ -335,15 +438,15 @@ func createBuildContext(dockerfileContent string, serverType string) (io.Reader,
 		return nil, err
 	}
 
-	jarPath := filepath.Join(projectRoot, "assets", "executables", fmt.Sprintf("%s.jar", serverType))
-
-	jarBytes, err := os.ReadFile(jarPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read server jar: %w", err)
-	}
-	// Add to tar with the path expected by Dockerfile
-	if err := addTarFile(tw, fmt.Sprintf("assets/executables/%s.jar", serverType), jarBytes); err != nil {
-		return nil, fmt.Errorf("failed to add server jar to tar: %w", err)
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join(projectRoot, filepath.FromSlash(file)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		// Add to tar with the path expected by Dockerfile
+		if err := addTarFile(tw, file, data); err != nil {
+			return nil, fmt.Errorf("failed to add %s to tar: %w", file, err)
+		}
 	}
 	return buf, nil
 }
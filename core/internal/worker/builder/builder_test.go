@@ -0,0 +1,394 @@
+package builder
+
+import (
+	config "beelder/internal/config/worker"
+	"beelder/internal/plans"
+	"beelder/internal/servertypes"
+	"beelder/internal/types"
+	"beelder/internal/worker/builder/fakeruntime"
+	"beelder/pkg/messaging/memory"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/volume"
+)
+
+// progressTopic is the topic the test builders publish their events to.
+const progressTopic = "progress"
+
+// newTestBuilder returns a builder running on an in-memory runtime and bus, in a project root holding
+// a vanilla 1.21.1 jar. Health checks poll every few milliseconds and trust a ready log line after 50ms.
+func newTestBuilder(t *testing.T) (*Builder, *fakeruntime.Runtime, *memory.Bus) {
+	t.Helper()
+
+	config.Set(config.WorkerConfig{
+		// Nothing listens on the test ports, so the Server List Ping fails fast and the logs decide
+		ProbeHost: "127.0.0.1",
+		BuilderConfig: config.BuilderConfig{
+			BuildTimeout:   5,
+			PortRangeStart: 45000,
+			PortRangeEnd:   45009,
+		},
+	})
+
+	root := t.TempDir()
+	jarDir := filepath.Join(root, "assets", "executables", "vanilla")
+	for _, dir := range []string{filepath.Join(root, "core"), jarDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(jarDir, "1.21.1.jar"), []byte("jar"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(root)
+
+	serverTypes, err := servertypes.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog, err := plans.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runtime := fakeruntime.New()
+	bus := memory.NewBus()
+	b := NewBuilder(bus.Publisher(progressTopic), runtime, serverTypes, catalog)
+	b.healthChecker.probeInterval = 10 * time.Millisecond
+	b.healthChecker.logReadyGrace = 50 * time.Millisecond
+	return b, runtime, bus
+}
+
+func newTestServerData() *types.CreateServerData {
+	return &types.CreateServerData{
+		ServerID:      "srv-1",
+		CorrelationID: "corr-1",
+		ServerConfig: &types.CreateServerConfig{
+			Name:          "test server",
+			ServerType:    "vanilla",
+			ServerVersion: "1.21.1",
+			Region:        "eu-west-1",
+			PlayerCount:   5,
+			RamPlan:       "2GB",
+			Difficulty:    "normal",
+		},
+	}
+}
+
+// publishedEvents returns the fields of the events the builder published.
+func publishedEvents(t *testing.T, bus *memory.Bus) []map[string]string {
+	t.Helper()
+
+	var published []map[string]string
+	for _, message := range bus.Messages(progressTopic) {
+		var fields map[string]string
+		if err := json.Unmarshal(message.Value, &fields); err != nil {
+			t.Fatalf("event %s is not a string map: %v", message.Key, err)
+		}
+		published = append(published, fields)
+	}
+	return published
+}
+
+// reportedStages returns the status, or the stage when there is one, of each published event,
+// with the progress percentage of progress events, e.g. "health_checking:30".
+func reportedStages(t *testing.T, bus *memory.Bus) []string {
+	t.Helper()
+
+	var stages []string
+	for _, fields := range publishedEvents(t, bus) {
+		stage := fields["status"]
+		if fields["stage"] != "" {
+			stage = fields["stage"]
+		}
+		if fields["progress"] != "" {
+			stage += ":" + fields["progress"]
+		}
+		stages = append(stages, stage)
+	}
+	return stages
+}
+
+// assertRolledBack checks that a failed build left no container, volume or port behind.
+func assertRolledBack(t *testing.T, b *Builder, runtime *fakeruntime.Runtime, serverID string) {
+	t.Helper()
+
+	ctx := context.Background()
+	containers, err := runtime.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 0 {
+		t.Errorf("%d containers left after the failed build", len(containers))
+	}
+
+	volumes, err := runtime.VolumeList(ctx, volume.ListOptions{Filters: serverIDFilter(serverID)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(volumes.Volumes) != 0 {
+		t.Errorf("%d volumes left after the failed build", len(volumes.Volumes))
+	}
+
+	// The released port is the lowest free one again
+	port, err := b.ports.Allocate("other-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port != 45000 {
+		t.Errorf("port 45000 was not released, got %d", port)
+	}
+}
+
+func TestBuildServerReportsBuildFailure(t *testing.T) {
+	b, runtime, bus := newTestBuilder(t)
+	runtime.DefaultScript(fakeruntime.Script{
+		BuildError: "COPY failed: file not found in build context",
+	})
+
+	err, stage := b.BuildServer(context.Background(), newTestServerData())
+	if err == nil {
+		t.Fatal("BuildServer succeeded with a failing image build")
+	}
+	if stage != "building_image" {
+		t.Errorf("stage = %q, want building_image", stage)
+	}
+	if !strings.Contains(err.Error(), "COPY failed") {
+		t.Errorf("error %q does not tell the build output", err)
+	}
+
+	if got, want := reportedStages(t, bus), []string{"building_image"}; !slices.Equal(got, want) {
+		t.Errorf("reported stages = %v, want %v", got, want)
+	}
+	if slices.Contains(runtime.Calls(), "ContainerCreate") {
+		t.Error("a container was created from a failed image build")
+	}
+	assertRolledBack(t, b, runtime, "srv-1")
+}
+
+func TestBuildServerRollsBackFailedStart(t *testing.T) {
+	b, runtime, bus := newTestBuilder(t)
+	runtime.DefaultScript(fakeruntime.Script{
+		StartError: errors.New("driver failed programming external connectivity: port is already allocated"),
+	})
+
+	err, stage := b.BuildServer(context.Background(), newTestServerData())
+	if err == nil {
+		t.Fatal("BuildServer succeeded with a container failing to start")
+	}
+	if stage != "starting_container" {
+		t.Errorf("stage = %q, want starting_container", stage)
+	}
+
+	if got, want := reportedStages(t, bus), []string{"building_image", "server_creation", "starting"}; !slices.Equal(got, want) {
+		t.Errorf("reported stages = %v, want %v", got, want)
+	}
+	assertRolledBack(t, b, runtime, "srv-1")
+}
+
+func TestBuildImageRebuildsChangedDockerfile(t *testing.T) {
+	b, runtime, _ := newTestBuilder(t)
+	ctx := context.Background()
+	serverData := newTestServerData()
+	serverData.ImageName = "vanilla-test"
+	contextFiles := []string{"assets/executables/vanilla/1.21.1.jar"}
+	dockerfile := "FROM alpine:latest\nCOPY assets/executables/vanilla/1.21.1.jar /server/server.jar\nCMD [\"java\"]\n"
+
+	builds := func() int {
+		count := 0
+		for _, call := range runtime.Calls() {
+			if call == "ImageBuild" {
+				count++
+			}
+		}
+		return count
+	}
+
+	steps := []struct {
+		name       string
+		dockerfile string
+		wantBuilds int
+	}{
+		{"missing image", dockerfile, 1},
+		{"same Dockerfile", dockerfile, 1},
+		{"changed Dockerfile", strings.Replace(dockerfile, "alpine:latest", "alpine:3.20", 1), 2},
+		{"changed Dockerfile again", strings.Replace(dockerfile, "alpine:latest", "alpine:3.20", 1), 2},
+	}
+	for _, step := range steps {
+		if err := b.buildImageFromDockerfile(ctx, step.dockerfile, contextFiles, serverData); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if got := builds(); got != step.wantBuilds {
+			t.Errorf("%s: %d image builds, want %d", step.name, got, step.wantBuilds)
+		}
+	}
+
+	image, err := runtime.ImageInspect(ctx, serverData.ImageName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := image.Config.Labels[dockerfileHashLabel], dockerfileHash(steps[2].dockerfile); got != want {
+		t.Errorf("image Dockerfile hash = %q, want %q", got, want)
+	}
+
+	// Images built before the hash label are rebuilt once
+	runtime.AddImage("vanilla-unlabeled")
+	serverData.ImageName = "vanilla-unlabeled"
+	if err := b.buildImageFromDockerfile(ctx, dockerfile, contextFiles, serverData); err != nil {
+		t.Fatal(err)
+	}
+	if got := builds(); got != 3 {
+		t.Errorf("%d image builds, want the unlabeled image rebuilt", got)
+	}
+}
+
+func TestBuildServerReportsSlowStart(t *testing.T) {
+	b, runtime, bus := newTestBuilder(t)
+	runtime.DefaultScript(fakeruntime.Script{
+		Logs: []fakeruntime.LogLine{
+			{After: 0, Text: "[Server thread/INFO]: Starting minecraft server version 1.21.1"},
+			{After: 100 * time.Millisecond, Text: "[Server thread/INFO]: Preparing level \"world\""},
+			{After: 200 * time.Millisecond, Text: "[Worker-Main-1/INFO]: Preparing spawn area: 0%"},
+			{After: 250 * time.Millisecond, Text: "[Worker-Main-1/INFO]: Preparing spawn area: 42%"},
+			{After: 400 * time.Millisecond, Text: "[Server thread/INFO]: Done (0.4s)! For help, type \"help\""},
+		},
+	})
+
+	serverData := newTestServerData()
+	start := time.Now()
+	err, stage := b.BuildServer(context.Background(), serverData)
+	if err != nil {
+		t.Fatalf("BuildServer failed at %s: %v", stage, err)
+	}
+	if stage != "ready" {
+		t.Errorf("stage = %q, want ready", stage)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("server reported ready after %v, before its ready line", elapsed)
+	}
+
+	want := []string{
+		"building_image",
+		"server_creation",
+		"starting",
+		"health_checking",
+		"health_checking:10",
+		"health_checking:30",
+		"health_checking:35",
+		"health_checking:60",
+	}
+	if got := reportedStages(t, bus); !slices.Equal(got, want) {
+		t.Errorf("reported stages = %v, want %v", got, want)
+	}
+	for _, fields := range publishedEvents(t, bus) {
+		if fields["server_id"] != "srv-1" {
+			t.Errorf("event %v is not tagged with the server ID", fields)
+		}
+	}
+
+	if serverData.ContainerID == "" || serverData.Port != 45000 {
+		t.Fatalf("server data not filled in: container %q, port %d", serverData.ContainerID, serverData.Port)
+	}
+	inspect, err := runtime.ContainerInspect(context.Background(), serverData.ContainerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !inspect.State.Running {
+		t.Errorf("container state = %s, want running", inspect.State.Status)
+	}
+	if _, ok := runtime.File(serverData.ContainerID, ServerPropertiesPath+"/"+serverPropertiesFile); !ok {
+		t.Error("server.properties was not copied before the start")
+	}
+}
+
+func TestBuildServerReportsCrashLogs(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   fakeruntime.Script
+		category FailureCategory
+		logLine  string
+	}{
+		{
+			// The server exits on its own, without a line matching an error pattern
+			name: "eula not accepted",
+			script: fakeruntime.Script{
+				Logs: []fakeruntime.LogLine{
+					{After: 0, Text: "[ServerMain/INFO]: Loading eula.txt"},
+					{After: 20 * time.Millisecond, Text: "[ServerMain/INFO]: You need to agree to the EULA in order to run the server."},
+				},
+				ExitAfter: 50 * time.Millisecond,
+				ExitCode:  0,
+			},
+			category: FailureEULA,
+			logLine:  "You need to agree to the EULA",
+		},
+		{
+			// The error line fails the startup while the container is still running
+			name: "out of memory",
+			script: fakeruntime.Script{
+				Logs: []fakeruntime.LogLine{
+					{After: 0, Text: "[Server thread/INFO]: Starting minecraft server version 1.21.1"},
+					{After: 20 * time.Millisecond, Text: "java.lang.OutOfMemoryError: Java heap space", Stderr: true},
+				},
+			},
+			category: FailureOutOfMemory,
+			logLine:  "java.lang.OutOfMemoryError",
+		},
+		{
+			name: "crash without a known cause",
+			script: fakeruntime.Script{
+				Logs: []fakeruntime.LogLine{
+					{After: 0, Text: "[Server thread/INFO]: Starting minecraft server version 1.21.1"},
+				},
+				ExitAfter: 50 * time.Millisecond,
+				ExitCode:  137,
+			},
+			category: FailureCrashed,
+			logLine:  "Starting minecraft server version",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, runtime, bus := newTestBuilder(t)
+			runtime.DefaultScript(tt.script)
+
+			err, stage := b.BuildServer(context.Background(), newTestServerData())
+			if err == nil {
+				t.Fatal("BuildServer succeeded with a crashing server")
+			}
+			if stage != "health_checking" {
+				t.Errorf("stage = %q, want health_checking", stage)
+			}
+
+			var startupErr *StartupError
+			if !errors.As(err, &startupErr) {
+				t.Fatalf("error %v is not a *StartupError", err)
+			}
+			if startupErr.Category != tt.category {
+				t.Errorf("category = %q, want %q", startupErr.Category, tt.category)
+			}
+			if startupErr.Explanation == "" {
+				t.Error("failure has no explanation")
+			}
+			if !slices.ContainsFunc(startupErr.Logs, func(line string) bool { return strings.Contains(line, tt.logLine) }) {
+				t.Errorf("logs %q do not contain %q", startupErr.Logs, tt.logLine)
+			}
+
+			stages := reportedStages(t, bus)
+			if last := stages[len(stages)-1]; !strings.HasPrefix(last, "health_checking") {
+				t.Errorf("last reported stage = %q, want health_checking", last)
+			}
+			assertRolledBack(t, b, runtime, "srv-1")
+		})
+	}
+}
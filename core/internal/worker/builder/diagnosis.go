@@ -0,0 +1,244 @@
+package builder
+
+import (
+	config "beelder/internal/config/worker"
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// FailureCategory is the cause of a failed server startup.
+type FailureCategory string
+
+const (
+	FailureEULA              FailureCategory = "eula_not_accepted"
+	FailureJavaVersion       FailureCategory = "wrong_java_version"
+	FailurePortInUse         FailureCategory = "port_in_use"
+	FailureOutOfMemory       FailureCategory = "out_of_memory"
+	FailureMissingDependency FailureCategory = "missing_mod_dependency"
+	FailureCorruptWorld      FailureCategory = "corrupt_world"
+	// The fallbacks when no log line tells the cause
+	FailureCrashed FailureCategory = "crashed"
+	FailureTimeout FailureCategory = "timeout"
+	FailureUnknown FailureCategory = "unknown"
+)
+
+// diagnoseTimeout bounds reading the logs and state of a failed container.
+const diagnoseTimeout = 5 * time.Second
+
+// maxTailLineLength bounds the log lines attached to a failure, to keep the event small.
+const maxTailLineLength = 1024
+
+// StartupError is returned when a server does not become ready, with the cause found in its logs.
+// The container is usually removed right after, so the last log lines are the only trace left of the failure.
+type StartupError struct {
+	Err         error
+	Category    FailureCategory
+	Explanation string
+	// Logs are the last lines the server logged, stdout and stderr interleaved.
+	Logs []string
+}
+
+func (e *StartupError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StartupError) Unwrap() error {
+	return e.Err
+}
+
+// failureRule recognizes a failure cause from the lines containing one of its patterns.
+type failureRule struct {
+	category    FailureCategory
+	explanation string
+	patterns    []string
+}
+
+// failureRules are checked in order, the first rule matching any line wins.
+// Causes that make the server print misleading follow-up errors come first, e.g. an unaccepted EULA stops the server
+// before it binds its port.
+var failureRules = []failureRule{
+	{
+		category:    FailureEULA,
+		explanation: "The Minecraft EULA was not accepted. The server stops until eula=true is set in eula.txt.",
+		patterns:    []string{"You need to agree to the EULA", "Failed to load eula.txt"},
+	},
+	{
+		category:    FailureJavaVersion,
+		explanation: "The server or one of its mods needs a different Java version than the one in the image.",
+		patterns: []string{
+			"UnsupportedClassVersionError",
+			"has been compiled by a more recent version of the Java Runtime",
+			"Unsupported Java detected",
+			"requires running the server with Java",
+		},
+	},
+	{
+		category:    FailurePortInUse,
+		explanation: "The server could not listen on its port, another process already uses it.",
+		patterns:    []string{"FAILED TO BIND TO PORT", "Address already in use", "java.net.BindException"},
+	},
+	{
+		category:    FailureOutOfMemory,
+		explanation: "The server ran out of memory. The plan is too small for this server, its mods or its world.",
+		patterns: []string{
+			"java.lang.OutOfMemoryError",
+			"There is insufficient memory for the Java Runtime Environment",
+			"Could not reserve enough space for object heap",
+		},
+	},
+	{
+		category:    FailureMissingDependency,
+		explanation: "A mod needs another mod, or another version of it, that is not installed.",
+		patterns: []string{
+			"Missing or unsupported mandatory dependencies",
+			"MissingModsException",
+			"Incompatible mods found!",
+			"Incompatible mod set!",
+			"Mod resolution failed",
+			"requires any version of",
+		},
+	},
+	{
+		category:    FailureCorruptWorld,
+		explanation: "The world could not be loaded, its files are damaged. Restore a backup or start a new world.",
+		patterns: []string{
+			"Failed to load level",
+			"Failed to read level",
+			"Exception reading level.dat",
+			"Couldn't load chunk",
+			"Corrupted chunk",
+		},
+	},
+}
+
+// classifyFailure returns the cause of a failed startup told by the log lines, or false when none is recognized.
+// A container killed for exceeding its memory limit is out of memory whatever it logged.
+func classifyFailure(lines []string, oomKilled bool) (FailureCategory, string, bool) {
+	if oomKilled {
+		return FailureOutOfMemory, "The container was killed for exceeding the memory limit of its plan.", true
+	}
+	for _, rule := range failureRules {
+		for _, line := range lines {
+			for _, pattern := range rule.patterns {
+				if strings.Contains(line, pattern) {
+					return rule.category, rule.explanation, true
+				}
+			}
+		}
+	}
+	return "", "", false
+}
+
+// diagnose wraps the error of a failed startup in a StartupError with the last log lines of the container
+// and their cause. timedOut tells whether the server was still starting when the build timed out.
+// Logs written before since, by a previous run of the container, are left out.
+func (hc *HealthChecker) diagnose(containerID string, since time.Time, err error, timedOut bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), diagnoseTimeout)
+	defer cancel()
+
+	lines, logsErr := hc.tailLogs(ctx, containerID, since, int(config.WorkerEnvs.BuilderConfig.FailureLogLines))
+	if logsErr != nil {
+		hc.logger.Warn("Failed to read the logs of the failed server", "container_id", containerID, "error", logsErr)
+	}
+
+	var state *container.State
+	if inspect, inspectErr := hc.runtime.ContainerInspect(ctx, containerID); inspectErr == nil && inspect.ContainerJSONBase != nil {
+		state = inspect.State
+	} else if inspectErr != nil {
+		hc.logger.Warn("Failed to inspect the failed server", "container_id", containerID, "error", inspectErr)
+	}
+
+	startupErr := &StartupError{Err: err, Logs: lines}
+	category, explanation, ok := classifyFailure(lines, state != nil && state.OOMKilled)
+	switch {
+	case ok:
+		startupErr.Category, startupErr.Explanation = category, explanation
+	case state != nil && !state.Running && state.Status != "":
+		startupErr.Category = FailureCrashed
+		startupErr.Explanation = fmt.Sprintf("The server stopped with exit code %d before it was ready, see the last log lines.", state.ExitCode)
+	case timedOut:
+		startupErr.Category = FailureTimeout
+		startupErr.Explanation = "The server was still starting when the build timed out. Large worlds and modpacks may need a larger plan."
+	default:
+		startupErr.Category = FailureUnknown
+		startupErr.Explanation = "The server failed to start, see the last log lines."
+	}
+
+	hc.logger.Info("Diagnosed failed startup", "container_id", containerID, "category", startupErr.Category, "log_lines", len(lines))
+	return startupErr
+}
+
+// timedLogLine is a log line and the time Docker received it, to interleave stdout and stderr.
+type timedLogLine struct {
+	at   time.Time
+	text string
+}
+
+// tailLogs returns the last n lines the container logged after since, or in all its runs when since is zero,
+// stdout and stderr in the order they were written.
+func (hc *HealthChecker) tailLogs(ctx context.Context, containerID string, since time.Time, n int) ([]string, error) {
+	options := container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Timestamps: true,
+		Tail:       strconv.Itoa(n),
+	}
+	if !since.IsZero() {
+		options.Since = since.Format(time.RFC3339Nano)
+	}
+	logs, err := hc.runtime.ContainerLogs(ctx, containerID, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read container logs: %w", err)
+	}
+	defer logs.Close()
+
+	var stdout, stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, logs); err != nil {
+		return nil, fmt.Errorf("failed to read container logs: %w", err)
+	}
+
+	timed := append(timestampedLines(stdout.String()), timestampedLines(stderr.String())...)
+	sort.SliceStable(timed, func(i, j int) bool {
+		return timed[i].at.Before(timed[j].at)
+	})
+	if len(timed) > n {
+		timed = timed[len(timed)-n:]
+	}
+
+	lines := make([]string, len(timed))
+	for i, line := range timed {
+		lines[i] = line.text
+	}
+	return lines, nil
+}
+
+// timestampedLines splits logs read with timestamps into lines, truncated to maxTailLineLength.
+// A line without a timestamp keeps the time of the line before it.
+func timestampedLines(logs string) []timedLogLine {
+	var lines []timedLogLine
+	var at time.Time
+	for _, line := range strings.Split(strings.TrimRight(logs, "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		if stamp, text, ok := strings.Cut(line, " "); ok {
+			if parsed, err := time.Parse(time.RFC3339Nano, stamp); err == nil {
+				at, line = parsed, text
+			}
+		}
+		line = strings.TrimRight(line, "\r")
+		if len(line) > maxTailLineLength {
+			line = line[:maxTailLineLength] + "..."
+		}
+		lines = append(lines, timedLogLine{at: at, text: line})
+	}
+	return lines
+}
@@ -0,0 +1,157 @@
+package builder
+
+import (
+	"beelder/internal/worker/builder/fakeruntime"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	tests := []struct {
+		name      string
+		lines     []string
+		oomKilled bool
+		// want is empty when no cause is recognized
+		want FailureCategory
+	}{
+		{
+			name: "eula",
+			lines: []string{
+				"[main/WARN]: Failed to load eula.txt",
+				"[main/INFO]: You need to agree to the EULA in order to run the server. Go to eula.txt for more info.",
+			},
+			want: FailureEULA,
+		},
+		{
+			name: "java version",
+			lines: []string{
+				"Error: LinkageError occurred while loading main class net.minecraft.bundler.Main",
+				"\tjava.lang.UnsupportedClassVersionError: net/minecraft/bundler/Main has been compiled by a more recent version of the Java Runtime (class file version 65.0), this version of the Java Runtime only recognizes class file versions up to 61.0",
+			},
+			want: FailureJavaVersion,
+		},
+		{
+			name: "port in use",
+			lines: []string{
+				"[Server thread/WARN]: **** FAILED TO BIND TO PORT!",
+				"[Server thread/WARN]: The exception was: java.net.BindException: Address already in use",
+			},
+			want: FailurePortInUse,
+		},
+		{
+			name: "out of memory",
+			lines: []string{
+				"[Server thread/ERROR]: Encountered an unexpected exception",
+				"java.lang.OutOfMemoryError: Java heap space",
+			},
+			want: FailureOutOfMemory,
+		},
+		{
+			name: "missing dependency",
+			lines: []string{
+				"[main/ERROR]: Incompatible mods found!",
+				"net.fabricmc.loader.impl.FormattedException: Some of your mods are incompatible with the game or each other!",
+				"\t - Mod 'Sodium Extra' (sodium-extra) 0.5.4 requires any version of sodium, which is missing!",
+			},
+			want: FailureMissingDependency,
+		},
+		{
+			name: "corrupt world",
+			lines: []string{
+				"[Server thread/INFO]: Preparing level \"world\"",
+				"[Server thread/ERROR]: Exception reading level.dat",
+				"java.util.zip.ZipException: Not in GZIP format",
+			},
+			want: FailureCorruptWorld,
+		},
+		{
+			// The server stops on the EULA, the bind error that follows is not the cause
+			name: "first rule wins",
+			lines: []string{
+				"[Server thread/WARN]: **** FAILED TO BIND TO PORT!",
+				"[main/INFO]: You need to agree to the EULA in order to run the server. Go to eula.txt for more info.",
+			},
+			want: FailureEULA,
+		},
+		{
+			name:      "killed for its memory limit",
+			lines:     []string{"[Server thread/INFO]: Preparing spawn area: 83%"},
+			oomKilled: true,
+			want:      FailureOutOfMemory,
+		},
+		{
+			name:  "no recognized cause",
+			lines: []string{"[Server thread/INFO]: Preparing spawn area: 83%", "Killed"},
+		},
+		{
+			name: "no logs",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			category, explanation, ok := classifyFailure(tt.lines, tt.oomKilled)
+			if tt.want == "" {
+				if ok {
+					t.Errorf("classifyFailure() = %s, want no cause", category)
+				}
+				return
+			}
+			if !ok || category != tt.want {
+				t.Errorf("classifyFailure() = %q, %v, want %s", category, ok, tt.want)
+			}
+			if explanation == "" {
+				t.Error("classifyFailure() has no explanation")
+			}
+		})
+	}
+}
+
+func TestDiagnoseFallbacks(t *testing.T) {
+	tests := []struct {
+		name      string
+		exitCode  int
+		oomKilled bool
+		// running keeps the container running, the server is still starting
+		running  bool
+		timedOut bool
+		want     FailureCategory
+	}{
+		{name: "exited", exitCode: 1, want: FailureCrashed},
+		{name: "killed for its memory limit", exitCode: 137, oomKilled: true, want: FailureOutOfMemory},
+		{name: "still starting at the timeout", running: true, timedOut: true, want: FailureTimeout},
+		{name: "running", running: true, want: FailureUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runtime := fakeruntime.New()
+			containerID, startedAt := startTestContainer(t, runtime, fakeruntime.Script{
+				Logs: []fakeruntime.LogLine{
+					{Text: "[Server thread/INFO]: Starting minecraft server version 1.21.1"},
+					{Text: "[Server thread/INFO]: Preparing spawn area: 83%"},
+				},
+			})
+			hc := newTestHealthChecker(runtime, time.Second)
+			if !tt.running {
+				if err := runtime.Crash(containerID, tt.exitCode, tt.oomKilled); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cause := errors.New("server did not become ready")
+			err := hc.diagnose(containerID, startedAt.Add(-time.Second), cause, tt.timedOut)
+			var startupErr *StartupError
+			if !errors.As(err, &startupErr) || !errors.Is(err, cause) {
+				t.Fatalf("diagnose() = %v, want a StartupError wrapping the failure", err)
+			}
+			if startupErr.Category != tt.want || startupErr.Explanation == "" {
+				t.Errorf("diagnosed %s: %q, want %s", startupErr.Category, startupErr.Explanation, tt.want)
+			}
+			if len(startupErr.Logs) != 2 {
+				t.Errorf("diagnosed with logs %q, want the 2 lines of the server", startupErr.Logs)
+			}
+		})
+	}
+}
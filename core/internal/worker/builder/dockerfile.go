@@ -0,0 +1,223 @@
+package builder
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/moby/buildkit/frontend/dockerfile/command"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+//go:embed templates/Dockerfile.tmpl
+var defaultDockerfileTemplate string
+
+// dockerfileTemplateFile is the name of a template overriding the default one for every server type.
+// A template named "<server type>.Dockerfile.tmpl" overrides it for a single server type.
+const dockerfileTemplateFile = "Dockerfile.tmpl"
+
+// ContextFile is a file of the build context copied into the image.
+type ContextFile struct {
+	// Source is the slash separated path relative to the project root, kept as-is inside the build context.
+	Source string
+	// Target is the file name inside the image.
+	Target string
+}
+
+// EnvVar is an environment variable set in the image.
+type EnvVar struct {
+	Name  string
+	Value string
+}
+
+// DockerfileSpec is the model the Dockerfile templates are rendered with.
+// Empty optional fields leave their section out of the default template.
+type DockerfileSpec struct {
+	ServerType  string
+	BaseImage   string
+	JavaVersion int
+	JavaPackage string
+	Env         []EnvVar
+	Artifact    ContextFile
+	// InstallSteps are shell commands run after the artifact is copied, optional.
+	InstallSteps []string
+	// Plugins are copied into /server/plugins, optional.
+	Plugins []ContextFile
+	// User runs the server as a non-root user owning DataDirs, optional.
+	User     string
+	DataDirs []string
+	Port     int
+	// Cmd is the exec form command starting the server.
+	Cmd []string
+}
+
+// ContextFiles returns the sources of every file the Dockerfile copies from the build context.
+func (s *DockerfileSpec) ContextFiles() []string {
+	files := []string{s.Artifact.Source}
+	for _, plugin := range s.Plugins {
+		files = append(files, plugin.Source)
+	}
+	return files
+}
+
+var dockerfileTemplateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	// quote makes a value a single word of ENV, LABEL or ARG instructions
+	"quote": quoteDockerfileWord,
+}
+
+// dockerfileWordEscaper escapes the characters the Dockerfile parser unescapes or expands inside double quotes.
+var dockerfileWordEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`)
+
+// quoteDockerfileWord double quotes a value for the Dockerfile parser, which substitutes variables inside
+// double quotes. Values with line breaks are rejected, an instruction ends with its line.
+func quoteDockerfileWord(value string) (string, error) {
+	if strings.ContainsAny(value, "\r\n") {
+		return "", fmt.Errorf("value %q spans several lines", value)
+	}
+	return `"` + dockerfileWordEscaper.Replace(value) + `"`, nil
+}
+
+// loadDockerfileTemplate returns the Dockerfile template of a server type.
+// Templates in dir override the embedded default one, an empty dir always uses the default template.
+func loadDockerfileTemplate(dir string, serverType string) (*template.Template, error) {
+	name, content := "default", defaultDockerfileTemplate
+
+	if dir != "" {
+		for _, file := range []string{serverType + "." + dockerfileTemplateFile, dockerfileTemplateFile} {
+			data, err := os.ReadFile(filepath.Join(dir, file))
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read Dockerfile template: %w", err)
+			}
+			name, content = file, string(data)
+			break
+		}
+	}
+
+	tmpl, err := template.New(name).Funcs(dockerfileTemplateFuncs).Option("missingkey=error").Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Dockerfile template %s: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// renderDockerfile renders a Dockerfile template and validates the result.
+func renderDockerfile(tmpl *template.Template, spec *DockerfileSpec) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, spec); err != nil {
+		return "", fmt.Errorf("failed to render Dockerfile template %s: %w", tmpl.Name(), err)
+	}
+
+	dockerfile := buf.String()
+	if err := validateDockerfile(dockerfile, spec.ContextFiles()); err != nil {
+		return "", fmt.Errorf("invalid Dockerfile rendered by template %s: %w", tmpl.Name(), err)
+	}
+	return dockerfile, nil
+}
+
+var exposedPortPattern = regexp.MustCompile(`^(\d{1,5}(-\d{1,5})?|\$\{?\w+\}?)(/(tcp|udp|sctp))?$`)
+
+// instructionArgs returns the arguments of an instruction parsed by the Dockerfile parser:
+// the elements of exec and JSON forms, the words of most instructions and the whole command of shell forms.
+func instructionArgs(node *parser.Node) []string {
+	var args []string
+	for next := node.Next; next != nil; next = next.Next {
+		args = append(args, next.Value)
+	}
+	return args
+}
+
+// validateDockerfile parses a Dockerfile with the parser of the Docker builder and rejects it before it is
+// sent to the Docker daemon when it has unknown instructions, missing arguments, invalid exec form commands,
+// copies of files missing from the build context or values left empty by the template.
+func validateDockerfile(dockerfile string, contextFiles []string) error {
+	if strings.Contains(dockerfile, "<no value>") {
+		return errors.New("the template references a missing value")
+	}
+
+	result, err := parser.Parse(strings.NewReader(dockerfile))
+	if err != nil {
+		return err
+	}
+
+	seenFrom, seenCmd := false, false
+	for _, node := range result.AST.Children {
+		keyword := strings.ToLower(node.Value)
+		where := fmt.Sprintf("line %d: %s", node.StartLine, strings.ToUpper(keyword))
+		args := instructionArgs(node)
+
+		// The parser keeps unknown instructions, the Docker builder rejects them
+		if _, ok := command.Commands[keyword]; !ok {
+			return fmt.Errorf("%s is not a Dockerfile instruction", where)
+		}
+		if len(args) == 0 {
+			return fmt.Errorf("%s has no arguments", where)
+		}
+		if !seenFrom && keyword != command.From && keyword != command.Arg {
+			return fmt.Errorf("%s comes before FROM", where)
+		}
+
+		switch keyword {
+		case command.From:
+			seenFrom = true
+		case command.Cmd, command.Entrypoint, command.Run, command.Shell:
+			seenCmd = seenCmd || keyword == command.Cmd || keyword == command.Entrypoint
+			// Invalid JSON falls back to the shell form, which would run the brackets as a command
+			if !node.Attributes["json"] && strings.HasPrefix(args[0], "[") {
+				return fmt.Errorf("%s has an invalid exec form command: %s", where, args[0])
+			}
+		case command.Copy, command.Add:
+			if err := validateCopy(node.Flags, args, contextFiles); err != nil {
+				return fmt.Errorf("%s %w", where, err)
+			}
+		case command.Expose:
+			for _, port := range args {
+				if !exposedPortPattern.MatchString(port) {
+					return fmt.Errorf("%s has an invalid port: %s", where, port)
+				}
+			}
+		}
+	}
+
+	if !seenFrom {
+		return errors.New("missing FROM instruction")
+	}
+	if !seenCmd {
+		return errors.New("missing CMD or ENTRYPOINT instruction")
+	}
+	return nil
+}
+
+// validateCopy checks that the sources of a COPY or ADD instruction are in the build context.
+// Copies from other stages or images are not checked.
+func validateCopy(flags []string, paths []string, contextFiles []string) error {
+	for _, flag := range flags {
+		if strings.HasPrefix(flag, "--from=") {
+			return nil
+		}
+	}
+
+	if len(paths) < 2 {
+		return errors.New("needs a source and a destination")
+	}
+	for _, source := range paths[:len(paths)-1] {
+		if !slices.Contains(contextFiles, source) {
+			return fmt.Errorf("copies %s, which is not in the build context", source)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package builder
+
+import (
+	config "beelder/internal/config/worker"
+	"beelder/internal/plans"
+	"beelder/internal/servertypes"
+	"beelder/internal/types"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/moby/buildkit/frontend/dockerfile/command"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+// installerConfigs are the server configs rendered into testdata/<server type>.Dockerfile,
+// for the server types running an installer in their install steps.
+var installerConfigs = map[string]*types.CreateServerConfig{
+	"forge": {
+		ServerVersion: "1.20.1-47.2.0",
+		RamPlan:       "4GB",
+	},
+	"fabric": {
+		ServerVersion: "1.21.1",
+		LoaderVersion: "0.16.5",
+		RamPlan:       "4GB",
+	},
+	// Without a loader version the installer picks the latest loader
+	"quilt": {
+		ServerVersion: "1.20.4",
+		RamPlan:       "4GB",
+	},
+}
+
+func TestInstallStepsDockerfileGolden(t *testing.T) {
+	serverTypes, err := servertypes.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog, err := plans.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	factory := NewDefaultStrategyFactory(serverTypes, catalog)
+	config.Set(config.WorkerConfig{})
+
+	for serverType, serverConfig := range installerConfigs {
+		t.Run(serverType, func(t *testing.T) {
+			serverConfig.ServerType = serverType
+			strategy, err := factory.GetStrategy(serverConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			spec := strategy.GetDockerfileSpec(serverConfig)
+			tmpl, err := loadDockerfileTemplate("", serverType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := renderDockerfile(tmpl, spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Every install step runs in its own RUN instruction, after the installer is copied
+			result, err := parser.Parse(strings.NewReader(got))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var runs []string
+			copied := false
+			for _, node := range result.AST.Children {
+				keyword, args := strings.ToLower(node.Value), instructionArgs(node)
+				switch {
+				case keyword == command.Copy && slices.Equal(args, []string{spec.Artifact.Source, "/server/" + spec.Artifact.Target}):
+					copied = true
+				case keyword == command.Run && copied:
+					runs = append(runs, args...)
+				}
+			}
+			definition, _ := serverTypes.Lookup(serverType)
+			// The EULA is accepted before the install steps
+			if len(runs) != len(definition.Install)+1 {
+				t.Fatalf("%d RUN instructions after the installer copy, want the EULA and %d install steps:\n%s", len(runs), len(definition.Install), got)
+			}
+			for i, step := range definition.Install {
+				if runs[i+1] != step {
+					t.Errorf("install step %d = %q, want %q", i, runs[i+1], step)
+				}
+			}
+
+			golden := filepath.Join("testdata", serverType+".Dockerfile")
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("Dockerfile differs from %s\ngot:\n%s\nwant:\n%s", golden, got, want)
+			}
+		})
+	}
+}
+
+func TestQuoteDockerfileWord(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "1.21.1", want: `"1.21.1"`},
+		{value: "", want: `""`},
+		{value: "-Xms1024M -Xmx1536M", want: `"-Xms1024M -Xmx1536M"`},
+		// Variables would be substituted by the Dockerfile parser
+		{value: "$HOME ${USER}", want: `"\$HOME \${USER}"`},
+		{value: `say "hi"`, want: `"say \"hi\""`},
+		// A trailing backslash would escape the closing quote, or continue the line without one
+		{value: `C:\worlds\`, want: `"C:\\worlds\\"`},
+		{value: "Café\t☕", want: "\"Café\t☕\""},
+		{value: "two\nlines", wantErr: true},
+		{value: "carriage\rreturn", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := quoteDockerfileWord(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("quoteDockerfileWord(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("quoteDockerfileWord(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRenderDockerfileQuotesEnv(t *testing.T) {
+	tmpl, err := loadDockerfileTemplate("", "vanilla")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := &DockerfileSpec{
+		ServerType:  "vanilla",
+		BaseImage:   "alpine:latest",
+		JavaPackage: "openjdk21-jre",
+		Env: []EnvVar{
+			{Name: "JVM_ARGS", Value: `-Dmessage="$HOME\"`},
+			{Name: "BROKEN", Value: "a\nRUN rm -rf /"},
+		},
+		Artifact: ContextFile{Source: "assets/executables/vanilla/1.21.1.jar", Target: "server.jar"},
+		Port:     25565,
+		Cmd:      []string{"sh", "-c", "exec java -jar server.jar nogui"},
+	}
+
+	// A line break would start a new instruction
+	if _, err := renderDockerfile(tmpl, spec); err == nil {
+		t.Fatal("rendered an ENV value with a line break")
+	}
+
+	spec.Env = spec.Env[:1]
+	dockerfile, err := renderDockerfile(tmpl, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `ENV JVM_ARGS="-Dmessage=\"\$HOME\\\""`; !strings.Contains(dockerfile, want+"\n") {
+		t.Errorf("Dockerfile does not contain %s:\n%s", want, dockerfile)
+	}
+}
+
+func TestValidateDockerfile(t *testing.T) {
+	contextFiles := []string{"assets/executables/vanilla/1.21.1.jar"}
+	const valid = "FROM alpine:latest\n" +
+		"WORKDIR /server\n" +
+		"COPY assets/executables/vanilla/1.21.1.jar /server/server.jar\n" +
+		"RUN echo \"eula=true\" > eula.txt && \\\n    chmod 644 eula.txt\n" +
+		"EXPOSE 25565\n" +
+		"CMD [\"java\", \"-jar\", \"server.jar\", \"nogui\"]\n"
+
+	tests := []struct {
+		name       string
+		dockerfile string
+		// wantErr is part of the error, empty when the Dockerfile is valid
+		wantErr string
+	}{
+		{name: "valid", dockerfile: valid},
+		{name: "arg before from", dockerfile: "ARG JAVA=21\n" + valid},
+		{name: "copy from a stage", dockerfile: valid + "COPY --from=build /out/plugins /server/plugins\n"},
+		{name: "missing value", dockerfile: strings.Replace(valid, "alpine:latest", "<no value>", 1), wantErr: "missing value"},
+		{name: "unknown instruction", dockerfile: valid + "INSTALL java\n", wantErr: "line 8: INSTALL is not a Dockerfile instruction"},
+		{name: "instruction before from", dockerfile: "RUN true\n" + valid, wantErr: "line 1: RUN comes before FROM"},
+		{name: "no arguments", dockerfile: valid + "WORKDIR\n", wantErr: "WORKDIR has no arguments"},
+		{name: "invalid exec form", dockerfile: strings.Replace(valid, `"nogui"]`, `"nogui"`, 1), wantErr: "CMD has an invalid exec form command"},
+		{name: "copy outside the context", dockerfile: valid + "COPY plugins/ /server/plugins/\n", wantErr: "copies plugins/, which is not in the build context"},
+		{name: "copy without destination", dockerfile: valid + "COPY assets/executables/vanilla/1.21.1.jar\n", wantErr: "needs a source and a destination"},
+		{name: "invalid port", dockerfile: valid + "EXPOSE minecraft\n", wantErr: "invalid port: minecraft"},
+		{name: "missing from", dockerfile: "ARG JAVA=21\n", wantErr: "missing FROM"},
+		{name: "missing cmd", dockerfile: strings.Split(valid, "CMD")[0], wantErr: "missing CMD or ENTRYPOINT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDockerfile(tt.dockerfile, contextFiles)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateDockerfile() = %v, want no error", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateDockerfile() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
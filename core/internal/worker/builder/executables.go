@@ -0,0 +1,76 @@
+package builder
+
+import (
+	"beelder/internal/servertypes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// serverJarPath returns the slash separated path, relative to the project root,
+// of the jar for a server type and version (e.g. "assets/executables/paper/1.21.1.jar").
+// Types with a shared artifact use a single installer.jar for every version
+// (e.g. "assets/executables/fabric/installer.jar").
+// The same path is used inside the Docker build context.
+func serverJarPath(definition *servertypes.Definition, serverVersion string) string {
+	if definition.Artifact.Shared {
+		return path.Join("assets", "executables", definition.Name, "installer.jar")
+	}
+	return path.Join("assets", "executables", definition.Name, serverVersion+".jar")
+}
+
+// pluginPath returns the slash separated path, relative to the project root, of a plugin bundled
+// with a server type (e.g. "assets/plugins/paper/spark.jar").
+func pluginPath(definition *servertypes.Definition, plugin string) string {
+	return path.Join("assets", "plugins", definition.Name, plugin)
+}
+
+// resolveServerJar checks that a jar exists for the requested server type and version
+// and returns its path relative to the project root.
+func resolveServerJar(definition *servertypes.Definition, serverVersion string) (string, error) {
+	if !servertypes.VersionPattern.MatchString(serverVersion) {
+		return "", fmt.Errorf("invalid server version: %q", serverVersion)
+	}
+
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		return "", err
+	}
+
+	jarPath := serverJarPath(definition, serverVersion)
+	if _, err := os.Stat(filepath.Join(projectRoot, filepath.FromSlash(jarPath))); err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("%s %s is not available", definition.Name, serverVersion)
+		}
+		return "", fmt.Errorf("failed to check server jar: %w", err)
+	}
+
+	return jarPath, nil
+}
+
+// maxImageTagLength is the longest image tag Docker accepts.
+const maxImageTagLength = 128
+
+// imageTagHashLength is the number of hex digits of the hash ending a shortened image tag.
+const imageTagHashLength = 16
+
+// imageNameFor returns the image reference for a server type, plan, version, loader version, Java runtime and JVM profile.
+// Docker repository names must be lowercase, the version is used as the tag and the loader version, if any,
+// the Java version and the JVM profile are appended to it so each of them gets its own image.
+// Tags longer than Docker allows are cut and end with a hash of the whole tag.
+func imageNameFor(serverType string, ramPlan string, serverVersion string, loaderVersion string, java JavaRuntime, jvmProfile string) string {
+	tag := serverVersion
+	if loaderVersion != "" {
+		tag += "-loader-" + loaderVersion
+	}
+	tag += fmt.Sprintf("-java%d-%s", java.Version, jvmProfile)
+	if len(tag) > maxImageTagLength {
+		sum := sha256.Sum256([]byte(tag))
+		tag = tag[:maxImageTagLength-imageTagHashLength-1] + "-" + hex.EncodeToString(sum[:])[:imageTagHashLength]
+	}
+	return strings.ToLower(fmt.Sprintf("ms-%s-%s", serverType, ramPlan)) + ":" + tag
+}
@@ -0,0 +1,59 @@
+package builder
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/distribution/reference"
+)
+
+func TestImageNameFor(t *testing.T) {
+	// The longest versions the API accepts
+	longVersion := "1." + strings.Repeat("9", 126)
+	longLoader := "0." + strings.Repeat("9", 62)
+
+	tests := []struct {
+		name          string
+		serverType    string
+		ramPlan       string
+		serverVersion string
+		loaderVersion string
+		want          string
+	}{
+		{name: "release", serverType: "vanilla", ramPlan: "2GB", serverVersion: "1.21.1", want: "ms-vanilla-2gb:1.21.1-java21-aikar"},
+		{name: "loader", serverType: "fabric", ramPlan: "4GB", serverVersion: "1.21.1", loaderVersion: "0.16.5", want: "ms-fabric-4gb:1.21.1-loader-0.16.5-java21-aikar"},
+		{name: "snapshot", serverType: "vanilla", ramPlan: "2GB", serverVersion: "24w14a", want: "ms-vanilla-2gb:24w14a-java21-aikar"},
+		{name: "long version", serverType: "paper", ramPlan: "2GB", serverVersion: longVersion},
+		{name: "long version and loader", serverType: "quilt", ramPlan: "12GB", serverVersion: longVersion, loaderVersion: longLoader},
+	}
+
+	tags := map[string]string{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := imageNameFor(tt.serverType, tt.ramPlan, tt.serverVersion, tt.loaderVersion, javaRuntimes[21], "aikar")
+			if tt.want != "" && got != tt.want {
+				t.Errorf("imageNameFor() = %s, want %s", got, tt.want)
+			}
+
+			named, err := reference.ParseNormalizedNamed(got)
+			if err != nil {
+				t.Fatalf("imageNameFor() = %s, not a valid image reference: %v", got, err)
+			}
+			tagged, ok := named.(reference.Tagged)
+			if !ok {
+				t.Fatalf("imageNameFor() = %s, want a tagged reference", got)
+			}
+			if other, ok := tags[tagged.Tag()]; ok {
+				t.Errorf("tag %s used by the %s and %s images", tagged.Tag(), other, tt.name)
+			}
+			tags[tagged.Tag()] = tt.name
+		})
+	}
+
+	// Shortened tags of versions differing past the cut stay apart
+	first := imageNameFor("paper", "2GB", longVersion, "", javaRuntimes[21], "aikar")
+	second := imageNameFor("paper", "2GB", longVersion[:len(longVersion)-1]+"8", "", javaRuntimes[21], "aikar")
+	if first == second {
+		t.Errorf("versions differing past the cut share the image %s", first)
+	}
+}
@@ -0,0 +1,1009 @@
+// Package fakeruntime provides an in-memory implementation of builder.ContainerRuntime.
+//
+// Containers do not run anything, their behaviour is scripted per image: build failures,
+// log lines written some time after start (slow starts), crashes with their logs and
+// the time it takes to honour a console "stop". Container state changes are reported as Docker events.
+// It lets the build flow run without a Docker daemon.
+package fakeruntime
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/build"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	dockerspec "github.com/moby/docker-image-spec/specs-go/v1"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// followInterval is how often a followed log stream checks for new lines.
+const followInterval = 10 * time.Millisecond
+
+// eventBuffer is the number of events kept for a subscriber, events past it are dropped.
+const eventBuffer = 256
+
+// LogLine is a line a container writes After the given delay from each start.
+type LogLine struct {
+	After  time.Duration
+	Text   string
+	Stderr bool
+}
+
+// Script describes how images and the containers created from them behave.
+type Script struct {
+	// BuildError makes ImageBuild report a failed build in its output stream, like the Docker daemon does.
+	BuildError string
+	// CreateError and StartError are returned by ContainerCreate and ContainerStart.
+	CreateError error
+	StartError  error
+	// Logs are written after every start of the container.
+	Logs []LogLine
+	// ExitAfter makes the container exit on its own with ExitCode, zero keeps it running.
+	ExitAfter time.Duration
+	ExitCode  int
+	OOMKilled bool
+	// StopDelay is the time between a console "stop" or a SIGTERM and the container exit.
+	StopDelay time.Duration
+	// MemoryUsage is reported by ContainerStatsOneShot.
+	MemoryUsage uint64
+	// Exec returns the output and exit code of commands run with ContainerExecCreate.
+	Exec func(cmd []string) (string, int)
+}
+
+type run struct {
+	start time.Time
+	end   time.Time
+}
+
+type fakeContainer struct {
+	id         string
+	name       string
+	created    time.Time
+	config     *container.Config
+	hostConfig *container.HostConfig
+	script     Script
+	state      container.ContainerState
+	exitCode   int
+	oomKilled  bool
+	runs       []run
+	exitTimer  *time.Timer
+	waiters    []chan container.WaitResponse
+	files      map[string][]byte
+	console    []string
+}
+
+type subscriber struct {
+	filters  filters.Args
+	messages chan events.Message
+}
+
+type fakeExec struct {
+	containerID string
+	cmd         []string
+	output      string
+	exitCode    int
+	done        bool
+}
+
+// Runtime is an in-memory container runtime. The zero value is not usable, use New.
+type Runtime struct {
+	mu            sync.Mutex
+	images        map[string]map[string]string
+	scripts       map[string]Script
+	defaultScript Script
+	containers    map[string]*fakeContainer
+	volumes       map[string]volume.Volume
+	execs         map[string]*fakeExec
+	subscribers   map[*subscriber]bool
+	nextID        int
+	calls         []string
+	now           func() time.Time
+}
+
+// New returns an empty runtime with no images, containers or volumes.
+func New() *Runtime {
+	return &Runtime{
+		images:      make(map[string]map[string]string),
+		scripts:     make(map[string]Script),
+		containers:  make(map[string]*fakeContainer),
+		volumes:     make(map[string]volume.Volume),
+		execs:       make(map[string]*fakeExec),
+		subscribers: make(map[*subscriber]bool),
+		now:         time.Now,
+	}
+}
+
+// Script sets the behaviour of an image and of the containers created from it.
+func (r *Runtime) Script(imageRef string, script Script) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.scripts[imageRef] = script
+}
+
+// DefaultScript sets the behaviour of images without their own script.
+func (r *Runtime) DefaultScript(script Script) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.defaultScript = script
+}
+
+// AddImage makes an image available without building it, with no labels.
+func (r *Runtime) AddImage(imageRef string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.images[imageRef] = map[string]string{}
+}
+
+// Calls returns the name of every runtime method called so far, in order.
+func (r *Runtime) Calls() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.calls...)
+}
+
+// File returns a file copied into a container with CopyToContainer.
+func (r *Runtime) File(containerID string, filePath string) ([]byte, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.containers[containerID]
+	if !ok {
+		return nil, false
+	}
+	data, ok := c.files[filePath]
+	return data, ok
+}
+
+// Console returns the commands written to a container console through ContainerAttach.
+func (r *Runtime) Console(containerID string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c, ok := r.containers[containerID]; ok {
+		return append([]string(nil), c.console...)
+	}
+	return nil
+}
+
+// Crash makes a running container exit right away with exitCode.
+func (r *Runtime) Crash(containerID string, exitCode int, oomKilled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, err := r.getLocked(containerID)
+	if err != nil {
+		return err
+	}
+	c.oomKilled = oomKilled
+	r.exitLocked(c, exitCode)
+	return nil
+}
+
+// Health reports a Docker health check result of a running container, "healthy" or "unhealthy",
+// as a health_status event.
+func (r *Runtime) Health(containerID string, status string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, err := r.getLocked(containerID)
+	if err != nil {
+		return err
+	}
+	if c.state != container.StateRunning {
+		return fmt.Errorf("%w: container %s is not running", cerrdefs.ErrConflict, containerID)
+	}
+	r.emitLocked(c, events.Action(string(events.ActionHealthStatus)+": "+status), nil)
+	return nil
+}
+
+func (r *Runtime) record(call string) {
+	r.calls = append(r.calls, call)
+}
+
+func (r *Runtime) scriptFor(imageRef string) Script {
+	if script, ok := r.scripts[imageRef]; ok {
+		return script
+	}
+	return r.defaultScript
+}
+
+func (r *Runtime) ImageBuild(ctx context.Context, buildContext io.Reader, options build.ImageBuildOptions) (build.ImageBuildResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record("ImageBuild")
+
+	if _, err := io.Copy(io.Discard, buildContext); err != nil {
+		return build.ImageBuildResponse{}, err
+	}
+
+	output := new(bytes.Buffer)
+	encoder := json.NewEncoder(output)
+	for _, tag := range options.Tags {
+		if message := r.scriptFor(tag).BuildError; message != "" {
+			encoder.Encode(map[string]any{
+				"errorDetail": map[string]string{"message": message},
+				"error":       message,
+			})
+			return build.ImageBuildResponse{Body: io.NopCloser(output)}, nil
+		}
+	}
+
+	for _, tag := range options.Tags {
+		r.images[tag] = maps.Clone(options.Labels)
+		encoder.Encode(map[string]string{"stream": "Successfully tagged " + tag + "\n"})
+	}
+	return build.ImageBuildResponse{Body: io.NopCloser(output)}, nil
+}
+
+func (r *Runtime) ImageInspect(ctx context.Context, imageID string, inspectOpts ...client.ImageInspectOption) (image.InspectResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record("ImageInspect")
+
+	labels, ok := r.images[imageID]
+	if !ok {
+		return image.InspectResponse{}, fmt.Errorf("%w: no such image: %s", cerrdefs.ErrNotFound, imageID)
+	}
+	return image.InspectResponse{
+		ID:       imageID,
+		RepoTags: []string{imageID},
+		Config:   &dockerspec.DockerOCIImageConfig{ImageConfig: ocispec.ImageConfig{Labels: maps.Clone(labels)}},
+	}, nil
+}
+
+func (r *Runtime) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *ocispec.Platform, containerName string) (container.CreateResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record("ContainerCreate")
+
+	script := r.scriptFor(config.Image)
+	if script.CreateError != nil {
+		return container.CreateResponse{}, script.CreateError
+	}
+	if _, ok := r.images[config.Image]; !ok {
+		return container.CreateResponse{}, fmt.Errorf("%w: no such image: %s", cerrdefs.ErrNotFound, config.Image)
+	}
+	for _, c := range r.containers {
+		if containerName != "" && c.name == containerName {
+			return container.CreateResponse{}, fmt.Errorf("%w: container name %q is already in use", cerrdefs.ErrConflict, containerName)
+		}
+	}
+
+	r.nextID++
+	id := fmt.Sprintf("%064x", r.nextID)
+	if hostConfig == nil {
+		hostConfig = &container.HostConfig{}
+	}
+	for _, m := range hostConfig.Mounts {
+		if _, ok := r.volumes[m.Source]; !ok && m.Source != "" {
+			r.volumes[m.Source] = volume.Volume{Name: m.Source, Driver: "local"}
+		}
+	}
+
+	c := &fakeContainer{
+		id:         id,
+		name:       containerName,
+		created:    r.now(),
+		config:     config,
+		hostConfig: hostConfig,
+		script:     script,
+		state:      container.StateCreated,
+		files:      make(map[string][]byte),
+	}
+	r.containers[id] = c
+	r.emitLocked(c, events.ActionCreate, nil)
+	return container.CreateResponse{ID: id}, nil
+}
+
+func (r *Runtime) ContainerStart(ctx context.Context, containerID string, options container.StartOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record("ContainerStart")
+
+	c, err := r.getLocked(containerID)
+	if err != nil {
+		return err
+	}
+	if c.script.StartError != nil {
+		return c.script.StartError
+	}
+	if c.state == container.StateRunning {
+		return nil
+	}
+
+	c.state = container.StateRunning
+	c.exitCode = 0
+	c.oomKilled = false
+	c.runs = append(c.runs, run{start: r.now()})
+	r.emitLocked(c, events.ActionStart, nil)
+	if c.script.ExitAfter > 0 {
+		r.exitLaterLocked(c, c.script.ExitAfter, c.script.ExitCode, c.script.OOMKilled)
+	}
+	return nil
+}
+
+func (r *Runtime) ContainerStop(ctx context.Context, containerID string, options container.StopOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record("ContainerStop")
+
+	c, err := r.getLocked(containerID)
+	if err != nil {
+		return err
+	}
+	if c.state == container.StateRunning {
+		r.emitLocked(c, events.ActionKill, map[string]string{"signal": "15"})
+		r.exitLocked(c, 0)
+	}
+	r.emitLocked(c, events.ActionStop, nil)
+	return nil
+}
+
+func (r *Runtime) ContainerKill(ctx context.Context, containerID, signal string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record("ContainerKill")
+
+	c, err := r.getLocked(containerID)
+	if err != nil {
+		return err
+	}
+	if c.state != container.StateRunning {
+		return fmt.Errorf("%w: container %s is not running", cerrdefs.ErrConflict, containerID)
+	}
+
+	if signal == "SIGTERM" || signal == "TERM" {
+		r.emitLocked(c, events.ActionKill, map[string]string{"signal": "15"})
+		r.exitLaterLocked(c, c.script.StopDelay, 0, false)
+		return nil
+	}
+	r.emitLocked(c, events.ActionKill, map[string]string{"signal": "9"})
+	r.exitLocked(c, 137)
+	return nil
+}
+
+func (r *Runtime) ContainerRemove(ctx context.Context, containerID string, options container.RemoveOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record("ContainerRemove")
+
+	c, err := r.getLocked(containerID)
+	if err != nil {
+		return err
+	}
+	if c.state == container.StateRunning {
+		if !options.Force {
+			return fmt.Errorf("%w: cannot remove running container %s", cerrdefs.ErrConflict, containerID)
+		}
+		r.emitLocked(c, events.ActionKill, map[string]string{"signal": "9"})
+		r.exitLocked(c, 137)
+	}
+	delete(r.containers, c.id)
+	r.emitLocked(c, events.ActionDestroy, nil)
+	return nil
+}
+
+func (r *Runtime) ContainerList(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record("ContainerList")
+
+	summaries := []container.Summary{}
+	for _, c := range r.containers {
+		if !options.All && c.state != container.StateRunning {
+			continue
+		}
+		if !matchesFilters(options.Filters, c.name, c.config.Labels) {
+			continue
+		}
+		summaries = append(summaries, r.summaryLocked(c))
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Created > summaries[j].Created
+	})
+	return summaries, nil
+}
+
+func (r *Runtime) ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record("ContainerInspect")
+
+	c, err := r.getLocked(containerID)
+	if err != nil {
+		return container.InspectResponse{}, err
+	}
+
+	state := &container.State{
+		Status:    c.state,
+		Running:   c.state == container.StateRunning,
+		ExitCode:  c.exitCode,
+		OOMKilled: c.oomKilled,
+	}
+	if len(c.runs) > 0 {
+		last := c.runs[len(c.runs)-1]
+		state.StartedAt = last.start.Format(time.RFC3339Nano)
+		if !last.end.IsZero() {
+			state.FinishedAt = last.end.Format(time.RFC3339Nano)
+		}
+	}
+
+	return container.InspectResponse{
+		ContainerJSONBase: &container.ContainerJSONBase{
+			ID:         c.id,
+			Name:       "/" + c.name,
+			Created:    c.created.Format(time.RFC3339Nano),
+			Image:      c.config.Image,
+			State:      state,
+			HostConfig: c.hostConfig,
+		},
+		Config: c.config,
+	}, nil
+}
+
+func (r *Runtime) ContainerUpdate(ctx context.Context, containerID string, updateConfig container.UpdateConfig) (container.UpdateResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record("ContainerUpdate")
+
+	c, err := r.getLocked(containerID)
+	if err != nil {
+		return container.UpdateResponse{}, err
+	}
+	if updateConfig.RestartPolicy.Name != "" {
+		c.hostConfig.RestartPolicy = updateConfig.RestartPolicy
+	}
+	return container.UpdateResponse{}, nil
+}
+
+func (r *Runtime) ContainerWait(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record("ContainerWait")
+
+	resultC := make(chan container.WaitResponse, 1)
+	errC := make(chan error, 1)
+
+	c, err := r.getLocked(containerID)
+	if err != nil {
+		errC <- err
+		return resultC, errC
+	}
+	if c.state != container.StateRunning {
+		resultC <- container.WaitResponse{StatusCode: int64(c.exitCode)}
+		return resultC, errC
+	}
+
+	c.waiters = append(c.waiters, resultC)
+	if ctx.Done() != nil {
+		go func() {
+			<-ctx.Done()
+			errC <- ctx.Err()
+		}()
+	}
+	return resultC, errC
+}
+
+// ContainerAttach returns a connection to the container console.
+// A "stop" line makes the container exit after its script StopDelay.
+func (r *Runtime) ContainerAttach(ctx context.Context, containerID string, options container.AttachOptions) (types.HijackedResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record("ContainerAttach")
+
+	c, err := r.getLocked(containerID)
+	if err != nil {
+		return types.HijackedResponse{}, err
+	}
+	if !c.config.OpenStdin {
+		return types.HijackedResponse{}, fmt.Errorf("%w: container %s has no open stdin", cerrdefs.ErrInvalidArgument, containerID)
+	}
+
+	clientConn, serverConn := net.Pipe()
+	go func() {
+		defer serverConn.Close()
+		scanner := bufio.NewScanner(serverConn)
+		for scanner.Scan() {
+			command := strings.TrimSpace(scanner.Text())
+			r.mu.Lock()
+			c.console = append(c.console, command)
+			if command == "stop" && c.state == container.StateRunning {
+				r.exitLaterLocked(c, c.script.StopDelay, 0, false)
+			}
+			r.mu.Unlock()
+		}
+	}()
+	return types.NewHijackedResponse(clientConn, "application/vnd.docker.raw-stream"), nil
+}
+
+// ContainerLogs returns the scripted log lines written so far, multiplexed like a non TTY container.
+// Since, Tail and Follow are honoured.
+func (r *Runtime) ContainerLogs(ctx context.Context, containerID string, options container.LogsOptions) (io.ReadCloser, error) {
+	r.mu.Lock()
+	r.record("ContainerLogs")
+	c, err := r.getLocked(containerID)
+	r.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	since, err := parseSince(options.Since)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	last := r.now()
+	lines, _ := r.linesLocked(c, since, time.Time{}, last)
+	r.mu.Unlock()
+	lines = tail(lines, options.Tail)
+
+	if !options.Follow {
+		buf := new(bytes.Buffer)
+		writeLines(buf, lines, options)
+		return io.NopCloser(buf), nil
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		defer writer.Close()
+		if err := writeLines(writer, lines, options); err != nil {
+			return
+		}
+
+		ticker := time.NewTicker(followInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				writer.CloseWithError(ctx.Err())
+				return
+			case <-ticker.C:
+			}
+
+			r.mu.Lock()
+			now := r.now()
+			newLines, finished := r.linesLocked(c, since, last, now)
+			r.mu.Unlock()
+			last = now
+			if err := writeLines(writer, newLines, options); err != nil {
+				return
+			}
+			if finished {
+				return
+			}
+		}
+	}()
+	return reader, nil
+}
+
+func (r *Runtime) ContainerStatsOneShot(ctx context.Context, containerID string) (container.StatsResponseReader, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record("ContainerStatsOneShot")
+
+	c, err := r.getLocked(containerID)
+	if err != nil {
+		return container.StatsResponseReader{}, err
+	}
+
+	stats := container.StatsResponse{
+		ID:   c.id,
+		Name: "/" + c.name,
+		Read: r.now(),
+	}
+	if c.state == container.StateRunning {
+		stats.MemoryStats = container.MemoryStats{
+			Usage: c.script.MemoryUsage,
+			Limit: uint64(c.hostConfig.Memory),
+		}
+	}
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return container.StatsResponseReader{}, err
+	}
+	return container.StatsResponseReader{Body: io.NopCloser(bytes.NewReader(data)), OSType: "linux"}, nil
+}
+
+// CopyToContainer extracts the tar archive into the container files, see File.
+func (r *Runtime) CopyToContainer(ctx context.Context, containerID, dstPath string, content io.Reader, options container.CopyToContainerOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record("CopyToContainer")
+
+	c, err := r.getLocked(containerID)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(content)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid tar archive: %w", err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		c.files[path.Join(dstPath, hdr.Name)] = data
+	}
+}
+
+func (r *Runtime) ContainerExecCreate(ctx context.Context, containerID string, options container.ExecOptions) (container.ExecCreateResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record("ContainerExecCreate")
+
+	c, err := r.getLocked(containerID)
+	if err != nil {
+		return container.ExecCreateResponse{}, err
+	}
+	if c.state != container.StateRunning {
+		return container.ExecCreateResponse{}, fmt.Errorf("%w: container %s is not running", cerrdefs.ErrConflict, containerID)
+	}
+
+	r.nextID++
+	id := fmt.Sprintf("exec-%d", r.nextID)
+	exec := &fakeExec{containerID: containerID, cmd: options.Cmd}
+	if c.script.Exec != nil {
+		exec.output, exec.exitCode = c.script.Exec(options.Cmd)
+	}
+	r.execs[id] = exec
+	return container.ExecCreateResponse{ID: id}, nil
+}
+
+func (r *Runtime) ContainerExecAttach(ctx context.Context, execID string, config container.ExecAttachOptions) (types.HijackedResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record("ContainerExecAttach")
+
+	exec, ok := r.execs[execID]
+	if !ok {
+		return types.HijackedResponse{}, fmt.Errorf("%w: no such exec: %s", cerrdefs.ErrNotFound, execID)
+	}
+	exec.done = true
+
+	clientConn, serverConn := net.Pipe()
+	go func() {
+		defer serverConn.Close()
+		stdcopy.NewStdWriter(serverConn, stdcopy.Stdout).Write([]byte(exec.output))
+	}()
+	return types.NewHijackedResponse(clientConn, "application/vnd.docker.multiplexed-stream"), nil
+}
+
+func (r *Runtime) ContainerExecInspect(ctx context.Context, execID string) (container.ExecInspect, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record("ContainerExecInspect")
+
+	exec, ok := r.execs[execID]
+	if !ok {
+		return container.ExecInspect{}, fmt.Errorf("%w: no such exec: %s", cerrdefs.ErrNotFound, execID)
+	}
+	return container.ExecInspect{
+		ExecID:      execID,
+		ContainerID: exec.containerID,
+		Running:     !exec.done,
+		ExitCode:    exec.exitCode,
+	}, nil
+}
+
+func (r *Runtime) VolumeCreate(ctx context.Context, options volume.CreateOptions) (volume.Volume, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record("VolumeCreate")
+
+	if v, ok := r.volumes[options.Name]; ok {
+		return v, nil
+	}
+	v := volume.Volume{Name: options.Name, Driver: "local", Labels: options.Labels}
+	r.volumes[options.Name] = v
+	return v, nil
+}
+
+func (r *Runtime) VolumeList(ctx context.Context, options volume.ListOptions) (volume.ListResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record("VolumeList")
+
+	response := volume.ListResponse{}
+	for _, v := range r.volumes {
+		if matchesFilters(options.Filters, v.Name, v.Labels) {
+			v := v
+			response.Volumes = append(response.Volumes, &v)
+		}
+	}
+	return response, nil
+}
+
+func (r *Runtime) VolumeRemove(ctx context.Context, volumeID string, force bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record("VolumeRemove")
+
+	if _, ok := r.volumes[volumeID]; !ok {
+		return fmt.Errorf("%w: no such volume: %s", cerrdefs.ErrNotFound, volumeID)
+	}
+	delete(r.volumes, volumeID)
+	return nil
+}
+
+// Events reports the create, start, kill, oom, die, stop and destroy events of the containers until ctx is done,
+// then sends the context error. It supports the "type", "event", "container", "label" and "name" filters.
+// A subscriber that does not keep up loses the events past eventBuffer.
+func (r *Runtime) Events(ctx context.Context, options events.ListOptions) (<-chan events.Message, <-chan error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record("Events")
+
+	sub := &subscriber{
+		filters:  options.Filters,
+		messages: make(chan events.Message, eventBuffer),
+	}
+	r.subscribers[sub] = true
+
+	errs := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		r.mu.Lock()
+		delete(r.subscribers, sub)
+		r.mu.Unlock()
+		errs <- ctx.Err()
+	}()
+	return sub.messages, errs
+}
+
+func (r *Runtime) Close() error {
+	return nil
+}
+
+// getLocked finds a container by id, id prefix or name.
+func (r *Runtime) getLocked(containerID string) (*fakeContainer, error) {
+	if c, ok := r.containers[containerID]; ok {
+		return c, nil
+	}
+	for _, c := range r.containers {
+		if c.name == strings.TrimPrefix(containerID, "/") || (len(containerID) >= 12 && strings.HasPrefix(c.id, containerID)) {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no such container: %s", cerrdefs.ErrNotFound, containerID)
+}
+
+func (r *Runtime) summaryLocked(c *fakeContainer) container.Summary {
+	summary := container.Summary{
+		ID:      c.id,
+		Names:   []string{"/" + c.name},
+		Image:   c.config.Image,
+		Created: c.created.UnixNano(),
+		Labels:  c.config.Labels,
+		State:   c.state,
+		Status:  string(c.state),
+	}
+	if c.state != container.StateRunning {
+		return summary
+	}
+	for containerPort, bindings := range c.hostConfig.PortBindings {
+		for _, binding := range bindings {
+			publicPort, _ := strconv.ParseUint(binding.HostPort, 10, 16)
+			summary.Ports = append(summary.Ports, container.Port{
+				IP:          binding.HostIP,
+				PrivatePort: uint16(containerPort.Int()),
+				PublicPort:  uint16(publicPort),
+				Type:        containerPort.Proto(),
+			})
+		}
+	}
+	return summary
+}
+
+// exitLaterLocked makes a running container exit after delay, replacing any pending exit.
+func (r *Runtime) exitLaterLocked(c *fakeContainer, delay time.Duration, exitCode int, oomKilled bool) {
+	if c.exitTimer != nil {
+		c.exitTimer.Stop()
+	}
+	runs := len(c.runs)
+	c.exitTimer = time.AfterFunc(delay, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		// Ignore exits scheduled for a previous run
+		if len(c.runs) != runs {
+			return
+		}
+		c.oomKilled = oomKilled
+		r.exitLocked(c, exitCode)
+	})
+}
+
+func (r *Runtime) exitLocked(c *fakeContainer, exitCode int) {
+	if c.state != container.StateRunning {
+		return
+	}
+	if c.exitTimer != nil {
+		c.exitTimer.Stop()
+		c.exitTimer = nil
+	}
+
+	c.state = container.StateExited
+	c.exitCode = exitCode
+	c.runs[len(c.runs)-1].end = r.now()
+	if c.oomKilled {
+		r.emitLocked(c, events.ActionOOM, nil)
+	}
+	r.emitLocked(c, events.ActionDie, map[string]string{"exitCode": strconv.Itoa(exitCode)})
+	for _, waiter := range c.waiters {
+		waiter <- container.WaitResponse{StatusCode: int64(exitCode)}
+	}
+	c.waiters = nil
+}
+
+// emitLocked sends a container event to the matching subscribers. Like Docker, the event attributes are
+// the container labels, its name and image, and the attributes of the action.
+func (r *Runtime) emitLocked(c *fakeContainer, action events.Action, attributes map[string]string) {
+	now := r.now()
+	message := events.Message{
+		Type:   events.ContainerEventType,
+		Action: action,
+		Actor: events.Actor{
+			ID:         c.id,
+			Attributes: map[string]string{"name": c.name, "image": c.config.Image},
+		},
+		Scope:    "local",
+		Time:     now.Unix(),
+		TimeNano: now.UnixNano(),
+	}
+	for key, value := range c.config.Labels {
+		message.Actor.Attributes[key] = value
+	}
+	for key, value := range attributes {
+		message.Actor.Attributes[key] = value
+	}
+
+	for sub := range r.subscribers {
+		if !matchesEvent(sub.filters, message, c.name, c.config.Labels) {
+			continue
+		}
+		select {
+		case sub.messages <- message:
+		default:
+		}
+	}
+}
+
+type timedLine struct {
+	at   time.Time
+	line LogLine
+}
+
+// linesLocked returns the lines written from since up to now, only keeping the ones
+// strictly after afterOnly when it is set, and whether the container stopped writing lines.
+func (r *Runtime) linesLocked(c *fakeContainer, since time.Time, afterOnly time.Time, now time.Time) ([]timedLine, bool) {
+	lines := []timedLine{}
+	for _, run := range c.runs {
+		for _, line := range c.script.Logs {
+			at := run.start.Add(line.After)
+			if at.After(now) || (!run.end.IsZero() && at.After(run.end)) {
+				continue
+			}
+			if at.Before(since) || (!afterOnly.IsZero() && !at.After(afterOnly)) {
+				continue
+			}
+			lines = append(lines, timedLine{at: at, line: line})
+		}
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].at.Before(lines[j].at)
+	})
+	return lines, c.state != container.StateRunning
+}
+
+func writeLines(w io.Writer, lines []timedLine, options container.LogsOptions) error {
+	stdout := stdcopy.NewStdWriter(w, stdcopy.Stdout)
+	stderr := stdcopy.NewStdWriter(w, stdcopy.Stderr)
+	for _, l := range lines {
+		text := l.line.Text + "\n"
+		if options.Timestamps {
+			text = l.at.Format(time.RFC3339Nano) + " " + text
+		}
+		out := stdout
+		if l.line.Stderr {
+			if !options.ShowStderr {
+				continue
+			}
+			out = stderr
+		} else if !options.ShowStdout {
+			continue
+		}
+		if _, err := out.Write([]byte(text)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func tail(lines []timedLine, n string) []timedLine {
+	count, err := strconv.Atoi(n)
+	if err != nil || count < 0 || count >= len(lines) {
+		return lines
+	}
+	return lines[len(lines)-count:]
+}
+
+// parseSince accepts the RFC 3339 and unix timestamp formats of the Docker API.
+func parseSince(since string) (time.Time, error) {
+	if since == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, since); err == nil {
+		return t, nil
+	}
+	seconds, err := strconv.ParseFloat(since, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: invalid since value %q", cerrdefs.ErrInvalidArgument, since)
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second))), nil
+}
+
+// matchesEvent supports the "type", "event" and "container" filters, and the filters of matchesFilters.
+// Like Docker, an "event" filter matches the actions with a status, e.g. "health_status" matches "health_status: healthy".
+func matchesEvent(args filters.Args, message events.Message, name string, labels map[string]string) bool {
+	if eventTypes := args.Get("type"); len(eventTypes) > 0 && !slices.Contains(eventTypes, string(message.Type)) {
+		return false
+	}
+	if actions := args.Get("event"); len(actions) > 0 {
+		action, _, _ := strings.Cut(string(message.Action), ":")
+		if !slices.Contains(actions, string(message.Action)) && !slices.Contains(actions, action) {
+			return false
+		}
+	}
+	if containers := args.Get("container"); len(containers) > 0 && !slices.Contains(containers, message.Actor.ID) && !slices.Contains(containers, name) {
+		return false
+	}
+	return matchesFilters(args, name, labels)
+}
+
+// matchesFilters supports the "label" (key or key=value) and "name" (substring) filters.
+func matchesFilters(args filters.Args, name string, labels map[string]string) bool {
+	for _, label := range args.Get("label") {
+		key, value, hasValue := strings.Cut(label, "=")
+		actual, ok := labels[key]
+		if !ok || (hasValue && actual != value) {
+			return false
+		}
+	}
+
+	names := args.Get("name")
+	if len(names) == 0 {
+		return true
+	}
+	for _, n := range names {
+		if strings.Contains(name, n) {
+			return true
+		}
+	}
+	return false
+}
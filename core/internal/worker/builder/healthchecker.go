@@ -2,30 +2,54 @@ package builder
 
 import (
 	config "beelder/internal/config/worker"
+	"beelder/internal/servertypes"
 	"beelder/internal/types"
+	"beelder/pkg/slp"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
-	"strings"
+	"net"
+	"strconv"
 	"time"
-
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/client"
 )
 
 type HealthChecker struct{
+	runtime ContainerRuntime
 	logger *slog.Logger
+	// probeInterval and logReadyGrace default to the constants of the same name, tests shorten them
+	probeInterval time.Duration
+	logReadyGrace time.Duration
 }
 
-func NewHealthChecker() *HealthChecker {
+func NewHealthChecker(runtime ContainerRuntime) *HealthChecker {
 	return &HealthChecker{
+		runtime: runtime,
 		logger: slog.Default().With("component", "healthchecker"),
+		probeInterval: probeInterval,
+		logReadyGrace: logReadyGrace,
 	}
 }
 
+// probeTimeout bounds each Server List Ping of a starting server, probeInterval is the time between two pings.
+const (
+	probeTimeout  = 2 * time.Second
+	probeInterval = 2 * time.Second
+)
+
+// logReadyGrace is how long a ready log line waits for the Server List Ping to confirm it.
+// Past it the server is considered ready on the logs alone, as the worker may not reach its port.
+const logReadyGrace = 10 * time.Second
+
 // waitForServerReady checks if the Minecraft server is actually ready to accept players
-// It does this by monitoring the container logs for the "Done" message that indicates server readiness
-func (hc *HealthChecker) waitForServerReady(containerID string, serverData *types.CreateServerData) error {
+// The server is ready once it answers a Server List Ping on its published port, like a Minecraft client would see it.
+// The container logs are followed as they are written: an error line of the server type fails the startup, and a ready
+// line is the fallback for servers the worker can not reach, accepted when no ping confirms it within logReadyGrace.
+// Only logs written after since are followed, so a restarted container is not reported ready by its previous run.
+// onProgress, optional, is called with the startup steps found in the logs, their percentage only grows.
+// A failed startup is returned as a *StartupError telling its cause, read while the container still exists.
+func (hc *HealthChecker) waitForServerReady(containerID string, serverData *types.CreateServerData, since time.Time, patterns servertypes.LogPatterns, onProgress func(percent int, message string)) error {
 	healthCheckerLogger := hc.logger.With(
 		"server_id", serverData.ServerID,
 		"server_type", serverData.ServerConfig.ServerType,
@@ -35,123 +59,95 @@ func (hc *HealthChecker) waitForServerReady(containerID string, serverData *type
 	)
 	healthCheckerLogger.Info("Starting health check for Minecraft server", "container_id", containerID)
 
-	ctx := context.Background()
-	cli, err := client.NewClientWithOpts(
-		client.WithHost(config.WorkerEnvs.DockerHost),
-	)
-	if err != nil {
-		return fmt.Errorf("failed to connect to new client for healthcheck: %w", err)
-	}
-	defer cli.Close()
-
+	timeout := time.Duration(config.WorkerEnvs.BuilderConfig.BuildTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 	start := time.Now()
+	probeAddress := net.JoinHostPort(config.WorkerEnvs.ProbeHost, strconv.Itoa(int(serverData.Port)))
 
-	// Monitor container logs for the "Done" message
-	for time.Since(start) < time.Duration(config.WorkerEnvs.BuilderConfig.BuildTimeout)*time.Second {
-		// Get container logs
-		logs, err := cli.ContainerLogs(ctx, containerID, container.LogsOptions{
-			ShowStdout: true,
-			ShowStderr: true,
-			Tail:       "200", // Get more lines to ensure we catch the message
+	// Error lines are matched first, a line matching both kinds fails the startup
+	follower := NewLogFollower(hc.runtime,
+		PatternMatcher(LogEventError, patterns.Errors),
+		PatternMatcher(LogEventReady, patterns.Ready),
+		ProgressMatcher(patterns.Progress),
+	)
+	events := make(chan LogEvent)
+	followErr := make(chan error, 1)
+	go func() {
+		followErr <- follower.Follow(ctx, containerID, since, func(event LogEvent) bool {
+			select {
+			case events <- event:
+				return true
+			case <-ctx.Done():
+				return false
+			}
 		})
-		if err != nil {
-			return fmt.Errorf("failed to get container logs: %v", err)
-		}
+	}()
+
+	probeTicker := time.NewTicker(hc.probeInterval)
+	defer probeTicker.Stop()
+
+	var readyLine string
+	var readyLineAt time.Time
+	lastPercent := -1
+	for {
+		select {
+		case <-probeTicker.C:
+			if serverData.Port != 0 {
+				status, err := hc.probe(ctx, probeAddress)
+				if err == nil {
+					healthCheckerLogger.Info("✅ Minecraft server is ready after", "duration", time.Since(start).Round(time.Second),
+						"signal", "server_list_ping", "version", status.Version.Name, "max_players", status.Players.Max, "latency", status.Latency)
+					return nil
+				}
+				healthCheckerLogger.Debug("Server list ping failed", "address", probeAddress, "error", err)
+			}
 
-		// Read ALL available logs, not just 4096 bytes
-		logContent := make([]byte, 0, 8192)
-		buf := make([]byte, 4096)
-		for {
-			n, err := logs.Read(buf)
-			if n > 0 {
-				logContent = append(logContent, buf[:n]...)
+			if readyLine != "" && (serverData.Port == 0 || time.Since(readyLineAt) >= hc.logReadyGrace) {
+				healthCheckerLogger.Info("✅ Minecraft server is ready after", "duration", time.Since(start).Round(time.Second),
+					"signal", "logs", "line", readyLine)
+				return nil
 			}
-			if err != nil {
-				break
+			healthCheckerLogger.Info("⏳ Server starting...", "elapsed", time.Since(start).Round(time.Second))
+
+		case event := <-events:
+			switch event.Kind {
+			case LogEventError:
+				return hc.diagnose(containerID, since, fmt.Errorf("server encountered an error during startup: %s", event.Line), false)
+			case LogEventReady:
+				if readyLine == "" {
+					readyLine, readyLineAt = event.Line, time.Now()
+					healthCheckerLogger.Info("Ready line logged, waiting for the server list ping", "line", event.Line)
+				}
+			case LogEventProgress:
+				// Repeated steps, e.g. the spawn area percentage, are only reported when they move forward
+				if event.Percent > lastPercent {
+					lastPercent = event.Percent
+					healthCheckerLogger.Info("Startup progress", "percent", event.Percent, "step", event.Detail)
+					if onProgress != nil {
+						onProgress(event.Percent, event.Detail)
+					}
+				}
 			}
-		}
-		logs.Close()
 
-		// Strip Docker log headers (first 8 bytes of each line)
-		logString := hc.stripDockerHeaders(string(logContent))
-
-		// Debug: print last few lines
-		lines := strings.Split(logString, "\n")
-		if len(lines) > 3 {
-			healthCheckerLogger.Info("Latest logs", "lines", strings.Join(lines[len(lines)-4:], "\n"))
-		}
-
-		// Check for Minecraft server ready indicators
-		if hc.isServerReady(logString) {
-			healthCheckerLogger.Info("✅ Minecraft server is ready after", "duration", time.Since(start).Round(time.Second))
-			return nil
-		}
-
-		// Check for common error conditions
-		if hc.hasServerError(logString) {
-			return fmt.Errorf("server encountered an error during startup - check logs")
-		}
+		case err := <-followErr:
+			if errors.Is(err, io.EOF) {
+				return hc.diagnose(containerID, since, fmt.Errorf("container stopped before the server was ready"), false)
+			}
+			if ctx.Err() != nil {
+				return hc.diagnose(containerID, since, fmt.Errorf("timeout: Minecraft server did not become ready within %v", timeout), true)
+			}
+			return err
 
-		// Show progress every 5 seconds
-		elapsed := time.Since(start)
-		if int(elapsed.Seconds())%5 == 0 {
-			healthCheckerLogger.Info("⏳ Server starting...", "elapsed", elapsed.Round(time.Second))
+		case <-ctx.Done():
+			return hc.diagnose(containerID, since, fmt.Errorf("timeout: Minecraft server did not become ready within %v", timeout), true)
 		}
-
-		time.Sleep(2 * time.Second)
 	}
-
-	return fmt.Errorf("timeout: Minecraft server did not become ready within %v", time.Duration(config.WorkerEnvs.BuilderConfig.BuildTimeout)*time.Second)
 }
 
-// stripDockerHeaders removes the 8-byte Docker log headers from log content
-func (hc *HealthChecker) stripDockerHeaders(logContent string) string {
-	lines := strings.Split(logContent, "\n")
-	var cleaned []string
-	for _, line := range lines {
-		// Docker prepends 8 bytes: [stream_type, 0, 0, 0, size (4 bytes)]
-		if len(line) > 8 {
-			cleaned = append(cleaned, line[8:])
-		} else if len(line) > 0 {
-			cleaned = append(cleaned, line)
-		}
-	}
-	return strings.Join(cleaned, "\n")
+// probe sends a Server List Ping to the server at address.
+func (hc *HealthChecker) probe(ctx context.Context, address string) (*slp.Status, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	return slp.Ping(ctx, address)
 }
-
-// isServerReady checks log content for indicators that the Minecraft server is ready
-func (hc *HealthChecker) isServerReady(logContent string) bool {
-	readyIndicators := []string{
-		"Done",                  // Paper/Spigot: "Done (4.123s)! For help, type \"help\""
-		"Server startup",          // Some servers: "Server startup complete"
-		"Time elapsed:",           // Vanilla: Shows when done loading
-		"For help, type \"help\"", // Common ready message
-	}
-
-	for _, indicator := range readyIndicators {
-		if strings.Contains(logContent, indicator) {
-			return true
-		}
-	}
-	return false
-}
-
-// hasServerError checks for common error conditions in logs
-func (hc *HealthChecker) hasServerError(logContent string) bool {
-	// Only check for critical errors that actually prevent server startup
-	// Ignore common warnings/errors that don't stop the server
-	criticalErrorIndicators := []string{
-		"Failed to bind to port",
-		"OutOfMemoryError",
-		"java.lang.RuntimeException",
-		"Server crashed",
-		"Encountered an unexpected exception",
-	}
-
-	for _, indicator := range criticalErrorIndicators {
-		if strings.Contains(logContent, indicator) {
-			return true
-		}
-	}
-	return false
-}
\ No newline at end of file
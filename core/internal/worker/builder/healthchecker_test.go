@@ -0,0 +1,157 @@
+package builder
+
+import (
+	config "beelder/internal/config/worker"
+	"beelder/internal/servertypes"
+	"beelder/internal/types"
+	"beelder/internal/worker/builder/fakeruntime"
+	"beelder/pkg/slp/slptest"
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+var testLogPatterns = servertypes.LogPatterns{
+	Ready:  []string{"Done ("},
+	Errors: []string{"Failed to bind to port"},
+}
+
+// startTestContainer creates and starts a container from an image scripted with script,
+// and returns its ID and start time.
+func startTestContainer(t *testing.T, runtime *fakeruntime.Runtime, script fakeruntime.Script) (string, time.Time) {
+	t.Helper()
+
+	ctx := context.Background()
+	runtime.AddImage("test-image")
+	runtime.Script("test-image", script)
+	resp, err := runtime.ContainerCreate(ctx, &container.Config{Image: "test-image"}, nil, nil, nil, "test-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	startedAt := time.Now()
+	if err := runtime.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	return resp.ID, startedAt
+}
+
+// newTestHealthChecker returns a health checker probing 127.0.0.1 every 10ms.
+func newTestHealthChecker(runtime *fakeruntime.Runtime, logReadyGrace time.Duration) *HealthChecker {
+	config.Set(config.WorkerConfig{
+		ProbeHost:     "127.0.0.1",
+		BuilderConfig: config.BuilderConfig{BuildTimeout: 5},
+	})
+
+	hc := NewHealthChecker(runtime)
+	hc.probeInterval = 10 * time.Millisecond
+	hc.logReadyGrace = logReadyGrace
+	return hc
+}
+
+// freePort returns a loopback port nothing listens on.
+func freePort(t *testing.T) int32 {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return int32(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func TestWaitForServerReadyOnServerListPing(t *testing.T) {
+	server, err := slptest.NewServer(slptest.StatusHandler(`{"version":{"name":"1.21.1","protocol":767},"players":{"max":20,"online":0}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	_, portString, _ := net.SplitHostPort(server.Addr)
+	port, _ := strconv.Atoi(portString)
+
+	runtime := fakeruntime.New()
+	// The server never logs a ready line, the ping alone tells it is ready
+	containerID, startedAt := startTestContainer(t, runtime, fakeruntime.Script{
+		Logs: []fakeruntime.LogLine{{Text: "Starting minecraft server version 1.21.1"}},
+	})
+	hc := newTestHealthChecker(runtime, time.Hour)
+
+	serverData := &types.CreateServerData{ServerID: "srv-1", ServerConfig: &types.CreateServerConfig{}, Port: int32(port)}
+	if err := hc.waitForServerReady(containerID, serverData, startedAt, testLogPatterns, nil); err != nil {
+		t.Fatalf("server answering pings not ready: %v", err)
+	}
+}
+
+func TestWaitForServerReadyFallsBackToLogs(t *testing.T) {
+	runtime := fakeruntime.New()
+	containerID, startedAt := startTestContainer(t, runtime, fakeruntime.Script{
+		Logs: []fakeruntime.LogLine{
+			// A line containing "Done" without the ready pattern is not a ready line
+			{After: 0, Text: "[Server thread/INFO]: Done loading plugins"},
+			{After: 50 * time.Millisecond, Text: "[Server thread/INFO]: Done (1.2s)! For help, type \"help\""},
+		},
+	})
+	hc := newTestHealthChecker(runtime, 100*time.Millisecond)
+
+	serverData := &types.CreateServerData{ServerID: "srv-1", ServerConfig: &types.CreateServerConfig{}, Port: freePort(t)}
+	start := time.Now()
+	if err := hc.waitForServerReady(containerID, serverData, startedAt, testLogPatterns, nil); err != nil {
+		t.Fatalf("server logging its ready line not ready: %v", err)
+	}
+	// The ready line waits logReadyGrace for a ping before it is trusted
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("server reported ready after %v, before the ready line and its grace period", elapsed)
+	}
+}
+
+func TestWaitForServerReadyTimesOut(t *testing.T) {
+	runtime := fakeruntime.New()
+	containerID, startedAt := startTestContainer(t, runtime, fakeruntime.Script{
+		Logs: []fakeruntime.LogLine{{Text: "[Server thread/INFO]: Done loading plugins"}},
+	})
+	hc := newTestHealthChecker(runtime, 100*time.Millisecond)
+	config.WorkerEnvs.BuilderConfig.BuildTimeout = 1
+
+	serverData := &types.CreateServerData{ServerID: "srv-1", ServerConfig: &types.CreateServerConfig{}, Port: freePort(t)}
+	err := hc.waitForServerReady(containerID, serverData, startedAt, testLogPatterns, nil)
+	startupErr, ok := err.(*StartupError)
+	if !ok {
+		t.Fatalf("error %v is not a *StartupError", err)
+	}
+	if startupErr.Category != FailureTimeout {
+		t.Errorf("category = %q, want %q", startupErr.Category, FailureTimeout)
+	}
+}
+
+func TestReadyPatternsSkipLoadingLines(t *testing.T) {
+	registry, err := servertypes.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Lines logged while plugins and mods load, before the server accepts players
+	loadingLines := []string{
+		"[Server thread/INFO]: Done loading 12 plugins",
+		"[modloading-worker-0/INFO]: Done loading mod configs",
+		"[main/INFO]: Done preparing level \"world\"",
+	}
+	readyLine := `[Server thread/INFO]: Done (4.123s)! For help, type "help"`
+
+	for _, serverType := range registry.Names() {
+		t.Run(serverType, func(t *testing.T) {
+			definition, _ := registry.Lookup(serverType)
+			matcher := PatternMatcher(LogEventReady, definition.LogPatterns.Ready)
+			for _, line := range loadingLines {
+				if _, ok := matcher.Match(line); ok {
+					t.Errorf("loading line %q matches a ready pattern of %v", line, definition.LogPatterns.Ready)
+				}
+			}
+			if _, ok := matcher.Match(readyLine); !ok {
+				t.Errorf("ready line %q matches no ready pattern of %v", readyLine, definition.LogPatterns.Ready)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package builder
+
+import (
+	"beelder/internal/servertypes"
+	"errors"
+	"fmt"
+)
+
+// ErrUnsupportedJavaRuntime is returned when no Java runtime can run a server type and version.
+var ErrUnsupportedJavaRuntime = errors.New("unsupported java runtime")
+
+// JavaRuntime is a Java runtime installed in the server images.
+type JavaRuntime struct {
+	Version int
+	// Package is the Alpine package of the runtime.
+	Package string
+}
+
+// javaRuntimes are the Java runtimes the builder can install, by major version.
+var javaRuntimes = map[int]JavaRuntime{
+	8:  {Version: 8, Package: "openjdk8-jre"},
+	17: {Version: 17, Package: "openjdk17-jre"},
+	21: {Version: 21, Package: "openjdk21-jre"},
+}
+
+// javaVersionFor returns the Java version required by a Minecraft version:
+// Java 8 up to 1.16, Java 17 from 1.17 to 1.20.4 and Java 21 from 1.20.5.
+func javaVersionFor(version servertypes.MinecraftVersion) int {
+	switch {
+	case version.Before(servertypes.MinecraftVersion{Minor: 17}):
+		return 8
+	case version.Before(servertypes.MinecraftVersion{Minor: 20, Patch: 5}):
+		return 17
+	default:
+		return 21
+	}
+}
+
+// resolveJavaRuntime returns the Java runtime of a server type and version.
+// The runtime pinned by the definition wins, otherwise it is chosen from the Minecraft version.
+// Versions older than the oldest one supported by the server type are refused.
+func resolveJavaRuntime(definition *servertypes.Definition, serverVersion string) (JavaRuntime, error) {
+	javaVersion := definition.JavaVersion
+
+	if definition.VersionScheme != servertypes.VersionSchemeNone {
+		version, ok := definition.MinecraftVersion(serverVersion)
+		if !ok {
+			return JavaRuntime{}, fmt.Errorf("%w: can not read the Minecraft version of %s %s", ErrUnsupportedJavaRuntime, definition.Name, serverVersion)
+		}
+
+		if !definition.SupportsMinecraftVersion(version) {
+			return JavaRuntime{}, fmt.Errorf("%w: %s supports Minecraft %s and newer, not %s", ErrUnsupportedJavaRuntime, definition.Name, definition.MinMinecraftVersion, version)
+		}
+
+		if javaVersion == 0 {
+			javaVersion = javaVersionFor(version)
+		}
+	}
+
+	runtime, ok := javaRuntimes[javaVersion]
+	if !ok {
+		return JavaRuntime{}, fmt.Errorf("%w: java %d is not available for %s %s", ErrUnsupportedJavaRuntime, javaVersion, definition.Name, serverVersion)
+	}
+	return runtime, nil
+}
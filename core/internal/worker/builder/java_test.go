@@ -0,0 +1,143 @@
+package builder
+
+import (
+	"beelder/internal/servertypes"
+	"beelder/internal/worker/builder/fakeruntime"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResolveJavaRuntime(t *testing.T) {
+	registry, err := servertypes.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinned := &servertypes.Definition{Name: "legacy", VersionScheme: servertypes.VersionSchemeNone, JavaVersion: 8}
+	unavailable := &servertypes.Definition{Name: "custom", VersionScheme: servertypes.VersionSchemeNone, JavaVersion: 11}
+
+	tests := []struct {
+		serverType string
+		definition *servertypes.Definition
+		version    string
+		want       int
+	}{
+		// Java 8 up to 1.16, 17 from 1.17 to 1.20.4 and 21 from 1.20.5
+		{serverType: "vanilla", version: "1.8.9", want: 8},
+		{serverType: "vanilla", version: "1.16.5", want: 8},
+		{serverType: "vanilla", version: "1.17", want: 17},
+		{serverType: "paper", version: "1.17.1", want: 17},
+		{serverType: "paper", version: "1.20.4", want: 17},
+		{serverType: "purpur", version: "1.20.5", want: 21},
+		{serverType: "vanilla", version: "1.21.1", want: 21},
+		// Forge versions start with the Minecraft version, NeoForge versions drop its leading "1."
+		{serverType: "forge", version: "1.17.1-37.1.1", want: 17},
+		{serverType: "forge", version: "1.20.1-47.2.0", want: 17},
+		{serverType: "forge", version: "1.20.6-50.1.0", want: 21},
+		{serverType: "neoforge", version: "20.2.86", want: 17},
+		{serverType: "neoforge", version: "20.4.237", want: 17},
+		{serverType: "neoforge", version: "20.6.119", want: 21},
+		{serverType: "neoforge", version: "21.1.77", want: 21},
+		// Older than the oldest version of the server type
+		{serverType: "forge", version: "1.16.5-36.2.39"},
+		{serverType: "fabric", version: "1.12.2"},
+		{serverType: "neoforge", version: "20.1.0"},
+		// No Minecraft version to read
+		{serverType: "vanilla", version: "latest"},
+		{serverType: "forge", version: "47.2.0"},
+		{serverType: "neoforge", version: "1.21.1"},
+		// The runtime pinned by the definition is used whatever the version
+		{definition: pinned, version: "b1.7.3", want: 8},
+		{definition: unavailable, version: "1.0"},
+	}
+
+	for _, tt := range tests {
+		definition := tt.definition
+		if definition == nil {
+			definition, _ = registry.Lookup(tt.serverType)
+		}
+		t.Run(definition.Name+" "+tt.version, func(t *testing.T) {
+			java, err := resolveJavaRuntime(definition, tt.version)
+			if tt.want == 0 {
+				if !errors.Is(err, ErrUnsupportedJavaRuntime) {
+					t.Errorf("resolveJavaRuntime() = java %d, %v, want ErrUnsupportedJavaRuntime", java.Version, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if java != javaRuntimes[tt.want] {
+				t.Errorf("resolveJavaRuntime() = %+v, want java %d", java, tt.want)
+			}
+		})
+	}
+}
+
+// addTestJar adds the jar of a server type to the project root of newTestBuilder.
+func addTestJar(t *testing.T, serverType string, name string) {
+	t.Helper()
+	dir := filepath.Join("assets", "executables", serverType)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("jar"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuildServerResolvesJavaRuntime(t *testing.T) {
+	tests := []struct {
+		serverType string
+		version    string
+		jar        string
+		// wantImage is empty when the build fails, the Java version is part of the tag
+		wantImage string
+	}{
+		{serverType: "vanilla", version: "1.16.5", jar: "1.16.5.jar", wantImage: "ms-vanilla-4gb:1.16.5-java8-aikar"},
+		{serverType: "vanilla", version: "1.20.4", jar: "1.20.4.jar", wantImage: "ms-vanilla-4gb:1.20.4-java17-aikar"},
+		{serverType: "vanilla", version: "1.21.1", jar: "1.21.1.jar", wantImage: "ms-vanilla-4gb:1.21.1-java21-aikar"},
+		// The jar is on disk but no runtime runs the version
+		{serverType: "fabric", version: "1.12.2", jar: "installer.jar"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.serverType+" "+tt.version, func(t *testing.T) {
+			b, runtime, bus := newTestBuilder(t)
+			runtime.DefaultScript(fakeruntime.Script{
+				Logs: []fakeruntime.LogLine{{After: 10 * time.Millisecond, Text: "[Server thread/INFO]: Done (0.1s)! For help, type \"help\""}},
+			})
+			addTestJar(t, tt.serverType, tt.jar)
+
+			serverData := newTestServerData()
+			serverData.ServerConfig.ServerType = tt.serverType
+			serverData.ServerConfig.ServerVersion = tt.version
+			// The plan runs every server type
+			serverData.ServerConfig.RamPlan = "4GB"
+			err, stage := b.BuildServer(context.Background(), serverData)
+
+			if tt.wantImage == "" {
+				if !errors.Is(err, ErrUnsupportedJavaRuntime) || stage != "resolving_java_runtime" {
+					t.Fatalf("BuildServer() = %v at %s, want ErrUnsupportedJavaRuntime at resolving_java_runtime", err, stage)
+				}
+				if len(runtime.Calls()) != 0 || len(bus.Messages(progressTopic)) != 0 {
+					t.Errorf("built %v and published %d events for a version no runtime runs", runtime.Calls(), len(bus.Messages(progressTopic)))
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("BuildServer failed at %s: %v", stage, err)
+			}
+			if serverData.ImageName != tt.wantImage {
+				t.Errorf("image = %q, want %q", serverData.ImageName, tt.wantImage)
+			}
+			if _, err := runtime.ImageInspect(context.Background(), tt.wantImage); err != nil {
+				t.Errorf("image %s not built: %v", tt.wantImage, err)
+			}
+		})
+	}
+}
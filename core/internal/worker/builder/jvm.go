@@ -0,0 +1,150 @@
+package builder
+
+import (
+	config "beelder/internal/config/worker"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// DefaultJVMProfile is used when the worker configuration does not select a profile.
+const DefaultJVMProfile = "aikar"
+
+// JVMProfile is a named set of JVM flags added after the memory flags.
+type JVMProfile struct {
+	Name string
+	// MinJava is the oldest Java version supporting the flags.
+	MinJava int
+	// Flags returns the flags for a maximum heap size in MB and a Java version.
+	Flags func(heapMB int64, javaVersion int) []string
+}
+
+// jvmProfiles are the JVM flag profiles that can be selected in the worker configuration.
+var jvmProfiles = map[string]JVMProfile{
+	// Aikar's G1 flags, see https://docs.papermc.io/paper/aikars-flags
+	"aikar": {
+		Name:    "aikar",
+		MinJava: 8,
+		Flags: func(heapMB int64, javaVersion int) []string {
+			// Heaps of 12GB and more use the large heap variant of the flags
+			newSize, maxNewSize, regionSize, reserve, occupancy := 30, 40, "8M", 20, 15
+			if heapMB >= 12*1024 {
+				newSize, maxNewSize, regionSize, reserve, occupancy = 40, 50, "16M", 15, 20
+			}
+			return []string{
+				"-XX:+UseG1GC",
+				"-XX:+ParallelRefProcEnabled",
+				"-XX:MaxGCPauseMillis=200",
+				"-XX:+UnlockExperimentalVMOptions",
+				"-XX:+DisableExplicitGC",
+				"-XX:+AlwaysPreTouch",
+				fmt.Sprintf("-XX:G1NewSizePercent=%d", newSize),
+				fmt.Sprintf("-XX:G1MaxNewSizePercent=%d", maxNewSize),
+				"-XX:G1HeapRegionSize=" + regionSize,
+				fmt.Sprintf("-XX:G1ReservePercent=%d", reserve),
+				"-XX:G1HeapWastePercent=5",
+				"-XX:G1MixedGCCountTarget=4",
+				fmt.Sprintf("-XX:InitiatingHeapOccupancyPercent=%d", occupancy),
+				"-XX:G1MixedGCLiveThresholdPercent=90",
+				"-XX:G1RSetUpdatingPauseTimePercent=5",
+				"-XX:SurvivorRatio=32",
+				"-XX:+PerfDisableSharedMem",
+				"-XX:MaxTenuringThreshold=1",
+				"-Dusing.aikars.flags=https://mcflags.emc.gs",
+				"-Daikars.new.flags=true",
+			}
+		},
+	},
+	// ZGC keeps pauses short on large heaps, generational ZGC is used from Java 21
+	"zgc": {
+		Name:    "zgc",
+		MinJava: 17,
+		Flags: func(heapMB int64, javaVersion int) []string {
+			flags := []string{"-XX:+UseZGC"}
+			if javaVersion >= 21 {
+				flags = append(flags, "-XX:+ZGenerational")
+			}
+			return append(flags,
+				"-XX:+AlwaysPreTouch",
+				"-XX:+DisableExplicitGC",
+				"-XX:+PerfDisableSharedMem",
+			)
+		},
+	},
+	// Only the memory flags, the JVM picks its own garbage collector
+	"minimal": {
+		Name:    "minimal",
+		MinJava: 8,
+		Flags: func(heapMB int64, javaVersion int) []string {
+			return nil
+		},
+	},
+}
+
+// JVMProfileNames returns the sorted names of the JVM flag profiles.
+func JVMProfileNames() []string {
+	names := make([]string, 0, len(jvmProfiles))
+	for name := range jvmProfiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// ValidateJVMProfiles checks that the worker configuration only selects existing JVM flag profiles.
+func ValidateJVMProfiles(profiles config.JVMProfilesConfig) error {
+	selected := []string{profiles.Default}
+	for _, name := range profiles.Plans {
+		selected = append(selected, name)
+	}
+	for _, name := range profiles.ServerTypes {
+		selected = append(selected, name)
+	}
+
+	for _, name := range selected {
+		if _, ok := jvmProfiles[name]; !ok {
+			return fmt.Errorf("unknown JVM profile %q (must be one of %v)", name, JVMProfileNames())
+		}
+	}
+	return nil
+}
+
+// jvmProfileFor returns the JVM flag profile selected for a server type and plan.
+// A profile selected for the server type wins over one selected for the plan.
+// Profiles needing a newer Java than the server runs fall back to the default profile.
+func jvmProfileFor(ramPlan string, serverType string, java JavaRuntime) JVMProfile {
+	profiles := config.WorkerEnvs.BuilderConfig.JVMProfiles
+
+	name := profiles.Default
+	if planProfile, ok := profiles.Plans[ramPlan]; ok {
+		name = planProfile
+	}
+	if typeProfile, ok := profiles.ServerTypes[serverType]; ok {
+		name = typeProfile
+	}
+
+	profile, ok := jvmProfiles[name]
+	if !ok || java.Version < profile.MinJava {
+		slog.Default().With("component", "builder").Warn(
+			"JVM profile not available, using the default profile",
+			"profile", name, "java_version", java.Version, "default", DefaultJVMProfile,
+		)
+		profile = jvmProfiles[DefaultJVMProfile]
+	}
+	return profile
+}
+
+// jvmArgs returns the memory flags followed by the flags of the profile.
+func jvmArgs(memoryMinMB int64, memoryMaxMB int64, profile JVMProfile, java JavaRuntime) []string {
+	args := []string{
+		fmt.Sprintf("-Xms%dM", memoryMinMB),
+		fmt.Sprintf("-Xmx%dM", memoryMaxMB),
+	}
+	return append(args, profile.Flags(memoryMaxMB, java.Version)...)
+}
+
+// joinJVMArgs joins JVM arguments for the JVM_ARGS environment variable, none of them contains spaces.
+func joinJVMArgs(args []string) string {
+	return strings.Join(args, " ")
+}
@@ -0,0 +1,235 @@
+package builder
+
+import (
+	config "beelder/internal/config/worker"
+	"beelder/internal/plans"
+	"slices"
+	"testing"
+)
+
+// aikarFlags are the flags of the aikar profile for heaps under 12GB.
+var aikarFlags = []string{
+	"-XX:+UseG1GC",
+	"-XX:+ParallelRefProcEnabled",
+	"-XX:MaxGCPauseMillis=200",
+	"-XX:+UnlockExperimentalVMOptions",
+	"-XX:+DisableExplicitGC",
+	"-XX:+AlwaysPreTouch",
+	"-XX:G1NewSizePercent=30",
+	"-XX:G1MaxNewSizePercent=40",
+	"-XX:G1HeapRegionSize=8M",
+	"-XX:G1ReservePercent=20",
+	"-XX:G1HeapWastePercent=5",
+	"-XX:G1MixedGCCountTarget=4",
+	"-XX:InitiatingHeapOccupancyPercent=15",
+	"-XX:G1MixedGCLiveThresholdPercent=90",
+	"-XX:G1RSetUpdatingPauseTimePercent=5",
+	"-XX:SurvivorRatio=32",
+	"-XX:+PerfDisableSharedMem",
+	"-XX:MaxTenuringThreshold=1",
+	"-Dusing.aikars.flags=https://mcflags.emc.gs",
+	"-Daikars.new.flags=true",
+}
+
+// aikarLargeHeapFlags are the flags of the aikar profile for heaps of 12GB and more.
+var aikarLargeHeapFlags = []string{
+	"-XX:+UseG1GC",
+	"-XX:+ParallelRefProcEnabled",
+	"-XX:MaxGCPauseMillis=200",
+	"-XX:+UnlockExperimentalVMOptions",
+	"-XX:+DisableExplicitGC",
+	"-XX:+AlwaysPreTouch",
+	"-XX:G1NewSizePercent=40",
+	"-XX:G1MaxNewSizePercent=50",
+	"-XX:G1HeapRegionSize=16M",
+	"-XX:G1ReservePercent=15",
+	"-XX:G1HeapWastePercent=5",
+	"-XX:G1MixedGCCountTarget=4",
+	"-XX:InitiatingHeapOccupancyPercent=20",
+	"-XX:G1MixedGCLiveThresholdPercent=90",
+	"-XX:G1RSetUpdatingPauseTimePercent=5",
+	"-XX:SurvivorRatio=32",
+	"-XX:+PerfDisableSharedMem",
+	"-XX:MaxTenuringThreshold=1",
+	"-Dusing.aikars.flags=https://mcflags.emc.gs",
+	"-Daikars.new.flags=true",
+}
+
+func flags(memory []string, profile []string) []string {
+	return append(slices.Clone(memory), profile...)
+}
+
+func TestGetResourceSettings(t *testing.T) {
+	catalog, err := plans.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	builtinPlan := func(name string) *plans.Plan {
+		plan, err := catalog.Lookup(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return plan
+	}
+	java8, java17, java21 := javaRuntimes[8], javaRuntimes[17], javaRuntimes[21]
+
+	tests := []struct {
+		name        string
+		plan        *plans.Plan
+		serverType  string
+		java        JavaRuntime
+		profiles    config.JVMProfilesConfig
+		wantProfile string
+		wantMin     string
+		wantMax     string
+		wantArgs    []string
+	}{
+		{
+			name:        "2GB plan with the default profile",
+			plan:        builtinPlan("2GB"),
+			serverType:  "paper",
+			java:        java21,
+			wantProfile: "aikar",
+			wantMin:     "1024M",
+			wantMax:     "1536M",
+			wantArgs:    flags([]string{"-Xms1024M", "-Xmx1536M"}, aikarFlags),
+		},
+		{
+			// The largest built-in heap is 11GB, still under the large heap switch
+			name:        "12GB plan keeps the regular G1 flags",
+			plan:        builtinPlan("12GB"),
+			serverType:  "forge",
+			java:        java17,
+			wantProfile: "aikar",
+			wantMin:     "6144M",
+			wantMax:     "11264M",
+			wantArgs:    flags([]string{"-Xms6144M", "-Xmx11264M"}, aikarFlags),
+		},
+		{
+			name:        "heap just under 12GB",
+			plan:        &plans.Plan{Name: "custom", MemoryLimitMB: 14336, HeapMinMB: 4096, HeapMaxMB: 12287},
+			serverType:  "paper",
+			java:        java21,
+			wantProfile: "aikar",
+			wantMin:     "4096M",
+			wantMax:     "12287M",
+			wantArgs:    flags([]string{"-Xms4096M", "-Xmx12287M"}, aikarFlags),
+		},
+		{
+			name:        "12GB heap switches to the large heap G1 flags",
+			plan:        &plans.Plan{Name: "custom", MemoryLimitMB: 14336, HeapMinMB: 4096, HeapMaxMB: 12288},
+			serverType:  "paper",
+			java:        java21,
+			wantProfile: "aikar",
+			wantMin:     "4096M",
+			wantMax:     "12288M",
+			wantArgs:    flags([]string{"-Xms4096M", "-Xmx12288M"}, aikarLargeHeapFlags),
+		},
+		{
+			name:        "zgc on Java 21 is generational",
+			plan:        builtinPlan("8GB"),
+			serverType:  "paper",
+			java:        java21,
+			profiles:    config.JVMProfilesConfig{Default: "aikar", Plans: map[string]string{"8GB": "zgc"}},
+			wantProfile: "zgc",
+			wantMin:     "4096M",
+			wantMax:     "7168M",
+			wantArgs: []string{
+				"-Xms4096M", "-Xmx7168M",
+				"-XX:+UseZGC", "-XX:+ZGenerational", "-XX:+AlwaysPreTouch", "-XX:+DisableExplicitGC", "-XX:+PerfDisableSharedMem",
+			},
+		},
+		{
+			name:        "zgc on Java 17 is not generational",
+			plan:        builtinPlan("8GB"),
+			serverType:  "forge",
+			java:        java17,
+			profiles:    config.JVMProfilesConfig{Default: "zgc"},
+			wantProfile: "zgc",
+			wantMin:     "4096M",
+			wantMax:     "7168M",
+			wantArgs: []string{
+				"-Xms4096M", "-Xmx7168M",
+				"-XX:+UseZGC", "-XX:+AlwaysPreTouch", "-XX:+DisableExplicitGC", "-XX:+PerfDisableSharedMem",
+			},
+		},
+		{
+			name:        "zgc falls back to aikar below Java 17",
+			plan:        builtinPlan("4GB"),
+			serverType:  "forge",
+			java:        java8,
+			profiles:    config.JVMProfilesConfig{Default: "zgc"},
+			wantProfile: "aikar",
+			wantMin:     "2048M",
+			wantMax:     "3584M",
+			wantArgs:    flags([]string{"-Xms2048M", "-Xmx3584M"}, aikarFlags),
+		},
+		{
+			name:       "server type profile wins over the plan profile",
+			plan:       builtinPlan("4GB"),
+			serverType: "vanilla",
+			java:       java21,
+			profiles: config.JVMProfilesConfig{
+				Default:     "aikar",
+				Plans:       map[string]string{"4GB": "zgc"},
+				ServerTypes: map[string]string{"vanilla": "minimal"},
+			},
+			wantProfile: "minimal",
+			wantMin:     "2048M",
+			wantMax:     "3584M",
+			wantArgs:    []string{"-Xms2048M", "-Xmx3584M"},
+		},
+		{
+			name:        "plan profile applies to other server types",
+			plan:        builtinPlan("4GB"),
+			serverType:  "paper",
+			java:        java21,
+			profiles:    config.JVMProfilesConfig{Default: "aikar", ServerTypes: map[string]string{"vanilla": "minimal"}, Plans: map[string]string{"4GB": "minimal"}},
+			wantProfile: "minimal",
+			wantMin:     "2048M",
+			wantMax:     "3584M",
+			wantArgs:    []string{"-Xms2048M", "-Xmx3584M"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Set(config.WorkerConfig{BuilderConfig: config.BuilderConfig{JVMProfiles: tt.profiles}})
+
+			settings := GetResourceSettings(tt.plan, tt.serverType, tt.java)
+			if settings.JVMProfile != tt.wantProfile {
+				t.Errorf("profile = %q, want %q", settings.JVMProfile, tt.wantProfile)
+			}
+			if settings.MemoryMin != tt.wantMin || settings.MemoryMax != tt.wantMax {
+				t.Errorf("memory = %s-%s, want %s-%s", settings.MemoryMin, settings.MemoryMax, tt.wantMin, tt.wantMax)
+			}
+			if settings.MemoryLimit != tt.plan.MemoryLimitMB*OneMB {
+				t.Errorf("memory limit = %d, want %d", settings.MemoryLimit, tt.plan.MemoryLimitMB*OneMB)
+			}
+			if !slices.Equal(settings.JVMArgs, tt.wantArgs) {
+				t.Errorf("JVM args =\n%q\nwant\n%q", settings.JVMArgs, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestValidateJVMProfiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		profiles config.JVMProfilesConfig
+		wantErr  bool
+	}{
+		{"known profiles", config.JVMProfilesConfig{Default: "aikar", Plans: map[string]string{"8GB": "zgc"}, ServerTypes: map[string]string{"vanilla": "minimal"}}, false},
+		{"unknown default", config.JVMProfilesConfig{Default: "shenandoah"}, true},
+		{"unknown plan profile", config.JVMProfilesConfig{Default: "aikar", Plans: map[string]string{"8GB": "g1"}}, true},
+		{"unknown server type profile", config.JVMProfilesConfig{Default: "aikar", ServerTypes: map[string]string{"forge": ""}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateJVMProfiles(tt.profiles); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateJVMProfiles() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
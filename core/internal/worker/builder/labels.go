@@ -0,0 +1,72 @@
+package builder
+
+import (
+	"beelder/internal/types"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"github.com/docker/docker/api/types/filters"
+)
+
+// Labels set on every container and volume created by the builder.
+const (
+	serverIDLabel      = "beelder.server_id"
+	serverTypeLabel    = "beelder.server_type"
+	serverVersionLabel = "beelder.server_version"
+	loaderVersionLabel = "beelder.loader_version"
+	ramPlanLabel       = "beelder.ram_plan"
+	volumePolicyLabel  = "beelder.volume_policy"
+	portLabel          = "beelder.port"
+)
+
+// dockerfileHashLabel is set on server images to the hash of the Dockerfile they were built from.
+const dockerfileHashLabel = "beelder.dockerfile_hash"
+
+// dockerfileHash returns the hex encoded SHA-256 of a rendered Dockerfile.
+func dockerfileHash(dockerfile string) string {
+	sum := sha256.Sum256([]byte(dockerfile))
+	return hex.EncodeToString(sum[:])
+}
+
+// serverLabels returns the container labels describing a server.
+func serverLabels(serverData *types.CreateServerData) map[string]string {
+	return map[string]string{
+		serverIDLabel:      serverData.ServerID,
+		serverTypeLabel:    serverData.ServerConfig.ServerType,
+		serverVersionLabel: serverData.ServerConfig.ServerVersion,
+		loaderVersionLabel: serverData.ServerConfig.LoaderVersion,
+		ramPlanLabel:       serverData.ServerConfig.RamPlan,
+		volumePolicyLabel:  serverData.ServerConfig.VolumePolicy,
+		portLabel:          strconv.Itoa(int(serverData.Port)),
+	}
+}
+
+// serverFromLabels rebuilds the server data of an existing container from its labels.
+func serverFromLabels(containerID string, imageName string, labels map[string]string) *types.CreateServerData {
+	port, _ := strconv.ParseInt(labels[portLabel], 10, 32)
+	return &types.CreateServerData{
+		ContainerID: containerID,
+		ServerID:    labels[serverIDLabel],
+		ImageName:   imageName,
+		Port:        int32(port),
+		ServerConfig: &types.CreateServerConfig{
+			ServerType:    labels[serverTypeLabel],
+			ServerVersion: labels[serverVersionLabel],
+			LoaderVersion: labels[loaderVersionLabel],
+			RamPlan:       labels[ramPlanLabel],
+			VolumePolicy:  labels[volumePolicyLabel],
+		},
+	}
+}
+
+// labeledServersFilter returns the Docker filter matching every container created by the builder.
+func labeledServersFilter() filters.Args {
+	return filters.NewArgs(filters.Arg("label", serverIDLabel))
+}
+
+// serverIDFilter returns the Docker filter matching resources labeled with a server ID.
+func serverIDFilter(serverID string) filters.Args {
+	return filters.NewArgs(filters.Arg("label", fmt.Sprintf("%s=%s", serverIDLabel, serverID)))
+}
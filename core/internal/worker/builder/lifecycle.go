@@ -0,0 +1,188 @@
+package builder
+
+import (
+	config "beelder/internal/config/worker"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// ErrServerNotFound is returned when no container is labeled with the requested server ID.
+var ErrServerNotFound = errors.New("server not found")
+
+// findServerContainer returns the container labeled with the server ID.
+func (b *Builder) findServerContainer(ctx context.Context, serverID string) (*container.Summary, error) {
+	containers, err := b.runtime.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: serverIDFilter(serverID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+	if len(containers) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrServerNotFound, serverID)
+	}
+	return &containers[0], nil
+}
+
+// IsServerRunning reports whether the container of a server is currently running.
+func (b *Builder) IsServerRunning(ctx context.Context, serverID string) (bool, error) {
+	serverContainer, err := b.findServerContainer(ctx, serverID)
+	if err != nil {
+		return false, err
+	}
+	return serverContainer.State == container.StateRunning, nil
+}
+
+// StopServer gracefully stops a running server.
+// It sends "stop" to the server console so the world is saved, waits for the
+// container to exit and kills it if it does not exit within the stop timeout.
+//
+// Returns an error and the stage where it happened if any step fails.
+func (b *Builder) StopServer(ctx context.Context, serverID string) (error, string) {
+	lifecycleLogger := b.logger.With(
+		"action", "stop_server",
+		"server_id", serverID,
+	)
+
+	serverContainer, err := b.findServerContainer(ctx, serverID)
+	if err != nil {
+		return err, "finding_server"
+	}
+	if serverContainer.State != container.StateRunning {
+		return fmt.Errorf("server %s is not running", serverID), "checking_state"
+	}
+
+	// Docker would bring the server back up after the console stop without this
+	if err := b.setRestartPolicy(ctx, serverContainer.ID, container.RestartPolicyDisabled); err != nil {
+		return err, "updating_restart_policy"
+	}
+
+	// Start waiting before sending the command so the exit cannot be missed
+	waitCh, waitErrCh := b.runtime.ContainerWait(ctx, serverContainer.ID, container.WaitConditionNotRunning)
+
+	lifecycleLogger.Info("Sending stop command to server console")
+	if err := b.sendConsoleCommand(ctx, serverContainer.ID, "stop"); err != nil {
+		// Containers without an open stdin still save the world on SIGTERM
+		lifecycleLogger.Warn("Failed to send console command, falling back to SIGTERM", "error", err)
+		if err := b.runtime.ContainerKill(ctx, serverContainer.ID, "SIGTERM"); err != nil {
+			return fmt.Errorf("failed to signal container: %w", err), "stopping_server"
+		}
+	}
+
+	stopTimeout := time.Duration(config.WorkerEnvs.BuilderConfig.StopTimeout) * time.Second
+	select {
+	case <-waitCh:
+		lifecycleLogger.Info("Server stopped gracefully")
+	case err := <-waitErrCh:
+		return fmt.Errorf("failed waiting for server to stop: %w", err), "stopping_server"
+	case <-time.After(stopTimeout):
+		lifecycleLogger.Warn("Server did not stop in time, killing it", "timeout", stopTimeout)
+		if err := b.runtime.ContainerKill(ctx, serverContainer.ID, "SIGKILL"); err != nil {
+			return fmt.Errorf("failed to kill container: %w", err), "killing_server"
+		}
+	}
+
+	return nil, "stopped"
+}
+
+// StartServer starts a stopped server and waits until it is ready to accept players.
+//
+// Returns an error and the stage where it happened if any step fails.
+func (b *Builder) StartServer(ctx context.Context, serverID string) (error, string) {
+	lifecycleLogger := b.logger.With(
+		"action", "start_server",
+		"server_id", serverID,
+	)
+
+	serverContainer, err := b.findServerContainer(ctx, serverID)
+	if err != nil {
+		return err, "finding_server"
+	}
+	if serverContainer.State == container.StateRunning {
+		return fmt.Errorf("server %s is already running", serverID), "checking_state"
+	}
+
+	// The log patterns of the server type are needed to tell when the server is ready
+	serverData := serverFromLabels(serverContainer.ID, serverContainer.Image, serverContainer.Labels)
+	strategy, err := b.strategies.GetStrategy(serverData.ServerConfig)
+	if err != nil {
+		return err, "resolving_server_type"
+	}
+
+	if err := b.setRestartPolicy(ctx, serverContainer.ID, container.RestartPolicyUnlessStopped); err != nil {
+		return err, "updating_restart_policy"
+	}
+
+	startedAt := time.Now()
+	if err := b.runtime.ContainerStart(ctx, serverContainer.ID, container.StartOptions{}); err != nil {
+		return fmt.Errorf("failed to start container: %w", err), "starting_container"
+	}
+	lifecycleLogger.Info("Container started, waiting for server to be ready", "container_id", serverContainer.ID)
+
+	if err := b.healthChecker.waitForServerReady(serverContainer.ID, serverData, startedAt, strategy.GetLogPatterns(), nil); err != nil {
+		// Leave the server stopped rather than restarting in a loop, its data is kept for inspection
+		lifecycleLogger.Error("health check failed, stopping server", "error", err)
+		if updateErr := b.setRestartPolicy(ctx, serverContainer.ID, container.RestartPolicyDisabled); updateErr != nil {
+			lifecycleLogger.Error("failed to disable restart policy", "error", updateErr)
+		}
+		if killErr := b.runtime.ContainerKill(ctx, serverContainer.ID, "SIGKILL"); killErr != nil {
+			lifecycleLogger.Error("failed to kill unhealthy container", "error", killErr)
+		}
+		return fmt.Errorf("health check failed for server %s: %w", serverID, err), "health_checking"
+	}
+
+	return nil, "ready"
+}
+
+// DeleteServer removes a stopped or running server container.
+// volumePolicy overrides the policy the server was created with, when empty
+// the server's policy and then the worker default are used.
+//
+// Returns an error and the stage where it happened if any step fails.
+func (b *Builder) DeleteServer(ctx context.Context, serverID string, volumePolicy string) (error, string) {
+	serverContainer, err := b.findServerContainer(ctx, serverID)
+	if err != nil {
+		return err, "finding_server"
+	}
+
+	if volumePolicy == "" {
+		volumePolicy = serverContainer.Labels[volumePolicyLabel]
+	}
+
+	if err := b.DestroyServer(ctx, serverID, serverContainer.ID, shouldPurgeVolumes(volumePolicy)); err != nil {
+		return err, "removing_server"
+	}
+
+	return nil, "deleted"
+}
+
+// setRestartPolicy updates the restart policy of an existing container.
+func (b *Builder) setRestartPolicy(ctx context.Context, containerID string, policy container.RestartPolicyMode) error {
+	if _, err := b.runtime.ContainerUpdate(ctx, containerID, container.UpdateConfig{
+		RestartPolicy: container.RestartPolicy{Name: policy},
+	}); err != nil {
+		return fmt.Errorf("failed to update restart policy: %w", err)
+	}
+	return nil
+}
+
+// sendConsoleCommand writes a command to the server console through the container stdin.
+func (b *Builder) sendConsoleCommand(ctx context.Context, containerID string, command string) error {
+	attach, err := b.runtime.ContainerAttach(ctx, containerID, container.AttachOptions{
+		Stream: true,
+		Stdin:  true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to attach to container: %w", err)
+	}
+	defer attach.Close()
+
+	if _, err := attach.Conn.Write([]byte(command + "\n")); err != nil {
+		return fmt.Errorf("failed to write console command: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package builder
+
+import (
+	"beelder/internal/servertypes"
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// maxLogLineLength bounds a log line, longer lines are split.
+const maxLogLineLength = 64 * 1024
+
+// LogEventKind is what a matcher found in a log line.
+type LogEventKind string
+
+const (
+	// LogEventReady means the server accepts players.
+	LogEventReady LogEventKind = "ready"
+	// LogEventError means the server will not finish starting.
+	LogEventError LogEventKind = "error"
+	// LogEventProgress is a step of the server startup.
+	LogEventProgress LogEventKind = "progress"
+)
+
+// LogEvent is a log line recognized by a matcher.
+type LogEvent struct {
+	Kind LogEventKind
+	Line string
+	// Detail is set by the matcher, e.g. the startup step of a progress event.
+	Detail string
+	// Percent is the startup progress of a progress event.
+	Percent int
+}
+
+// LogMatcher recognizes the log lines of a container.
+// Matchers are called from a single goroutine, one line at a time and in the order of the logs.
+type LogMatcher interface {
+	Match(line string) (LogEvent, bool)
+}
+
+// LogMatcherFunc is a function used as a LogMatcher.
+type LogMatcherFunc func(line string) (LogEvent, bool)
+
+func (f LogMatcherFunc) Match(line string) (LogEvent, bool) {
+	return f(line)
+}
+
+// PatternMatcher returns a matcher reporting the lines containing one of the patterns as events of the given kind.
+func PatternMatcher(kind LogEventKind, patterns []string) LogMatcher {
+	return LogMatcherFunc(func(line string) (LogEvent, bool) {
+		for _, pattern := range patterns {
+			if strings.Contains(line, pattern) {
+				return LogEvent{Kind: kind, Line: line, Detail: pattern}, true
+			}
+		}
+		return LogEvent{}, false
+	})
+}
+
+// ProgressMatcher returns a matcher reporting the startup steps of a server type as progress events,
+// with the step message in Detail.
+func ProgressMatcher(patterns []servertypes.ProgressPattern) LogMatcher {
+	return LogMatcherFunc(func(line string) (LogEvent, bool) {
+		for i := range patterns {
+			if percent, ok := patterns[i].Match(line); ok {
+				return LogEvent{Kind: LogEventProgress, Line: line, Detail: patterns[i].Message, Percent: percent}, true
+			}
+		}
+		return LogEvent{}, false
+	})
+}
+
+// LogFollower streams the logs of a container through a set of matchers.
+type LogFollower struct {
+	runtime  ContainerRuntime
+	matchers []LogMatcher
+}
+
+// NewLogFollower returns a follower passing every log line to the matchers, in order.
+// The first matcher recognizing a line decides its event.
+func NewLogFollower(runtime ContainerRuntime, matchers ...LogMatcher) *LogFollower {
+	return &LogFollower{
+		runtime:  runtime,
+		matchers: matchers,
+	}
+}
+
+// Follow streams the logs the container writes after since and passes each line once to the matchers.
+// handle is called with every event, following stops when it returns false.
+// Lines keep their order within stdout and within stderr.
+//
+// Follow returns nil when handle stopped it, io.EOF when the log stream ended because the container stopped,
+// and the context error when ctx is cancelled or times out.
+func (f *LogFollower) Follow(ctx context.Context, containerID string, since time.Time, handle func(LogEvent) bool) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	logs, err := f.runtime.ContainerLogs(ctx, containerID, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+		Since:      since.Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to follow container logs: %w", err)
+	}
+	// Closing the stream unblocks the demultiplexer when the context ends first
+	go func() {
+		<-ctx.Done()
+		logs.Close()
+	}()
+
+	lines := make(chan string)
+	scanErrs := make(chan error, 1)
+	go func() {
+		scanErrs <- demultiplexLines(ctx, logs, lines)
+		close(lines)
+	}()
+
+	for line := range lines {
+		event, ok := f.match(line)
+		if ok && !handle(event) {
+			cancel()
+			for range lines {
+				// Drain the lines scanned before the stream closed
+			}
+			return nil
+		}
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err := <-scanErrs; err != nil {
+		return fmt.Errorf("failed to read container logs: %w", err)
+	}
+	return io.EOF
+}
+
+func (f *LogFollower) match(line string) (LogEvent, bool) {
+	for _, matcher := range f.matchers {
+		if event, ok := matcher.Match(line); ok {
+			return event, true
+		}
+	}
+	return LogEvent{}, false
+}
+
+// demultiplexLines splits the multiplexed stdout and stderr frames of a non TTY container log stream
+// and sends their lines, each stream with its own reader so a line split across frames stays whole.
+// It returns when the stream ends.
+func demultiplexLines(ctx context.Context, logs io.Reader, lines chan<- string) error {
+	stdoutReader, stdoutWriter := io.Pipe()
+	stderrReader, stderrWriter := io.Pipe()
+
+	scanned := make(chan struct{}, 2)
+	for _, reader := range []io.Reader{stdoutReader, stderrReader} {
+		go func() {
+			defer func() { scanned <- struct{}{} }()
+			defer io.Copy(io.Discard, reader) // Let stdcopy finish when the context ends first
+
+			lineReader := bufio.NewReaderSize(reader, maxLogLineLength)
+			for {
+				line, err := lineReader.ReadSlice('\n')
+				if len(line) > 0 {
+					select {
+					case lines <- strings.TrimRight(string(line), "\r\n"):
+					case <-ctx.Done():
+						return
+					}
+				}
+				if err != nil && err != bufio.ErrBufferFull {
+					return
+				}
+			}
+		}()
+	}
+
+	_, err := stdcopy.StdCopy(stdoutWriter, stderrWriter, logs)
+	stdoutWriter.Close()
+	stderrWriter.Close()
+	<-scanned
+	<-scanned
+
+	if ctx.Err() != nil {
+		return nil // The stream was closed on purpose
+	}
+	return err
+}
@@ -0,0 +1,387 @@
+package builder
+
+import (
+	config "beelder/internal/config/worker"
+	"beelder/pkg/messaging"
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// Statuses of a live server, reported in "server.status.changed" events.
+const (
+	StatusRunning   = "running"
+	StatusUnhealthy = "unhealthy"
+	StatusCrashed   = "crashed"
+	StatusStopped   = "stopped"
+)
+
+// unhealthyAfter is the number of failed probes in a row after which a running server is unhealthy.
+const unhealthyAfter = 3
+
+// eventsRetryInterval is the time between two subscriptions to the Docker events when the stream fails.
+const eventsRetryInterval = 5 * time.Second
+
+// monitoredServer is the state of a server watched by the monitor.
+type monitoredServer struct {
+	containerID  string
+	port         int32
+	status       string
+	failedProbes int
+	// stopRequested is set when the container is stopped or killed through Docker, outside of the worker.
+	stopRequested bool
+	// oomKilled is set when the kernel killed a process of the container for exceeding its memory limit.
+	oomKilled bool
+}
+
+// Monitor watches the live servers once they are ready. It follows the Docker events of their containers
+// (die, oom, health_status) and sends them a Server List Ping every monitor interval, then publishes their
+// status changes as "server.status.changed" events.
+//
+// A server that exits for good is no longer watched and onDown is called with its ID, so the worker releases
+// its live server slot. A server Docker restarts after a crash is reported crashed and keeps being watched
+// until it answers again.
+type Monitor struct {
+	producer      messaging.Publisher
+	runtime       ContainerRuntime
+	healthChecker *HealthChecker
+	logger        *slog.Logger
+	onDown        func(serverID string)
+
+	mu      sync.Mutex
+	servers map[string]*monitoredServer
+}
+
+func NewMonitor(producer messaging.Publisher, runtime ContainerRuntime, onDown func(serverID string)) *Monitor {
+	return &Monitor{
+		producer:      producer,
+		runtime:       runtime,
+		healthChecker: NewHealthChecker(runtime),
+		logger:        slog.Default().With("component", "monitor"),
+		onDown:        onDown,
+		servers:       make(map[string]*monitoredServer),
+	}
+}
+
+// Watch starts watching a running server.
+func (m *Monitor) Watch(ctx context.Context, serverID string) error {
+	containers, err := m.runtime.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: serverIDFilter(serverID),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list containers: %w", err)
+	}
+	if len(containers) == 0 {
+		return fmt.Errorf("%w: %s", ErrServerNotFound, serverID)
+	}
+	serverData := serverFromLabels(containers[0].ID, containers[0].Image, containers[0].Labels)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.servers[serverID] = &monitoredServer{
+		containerID: serverData.ContainerID,
+		port:        serverData.Port,
+		status:      StatusRunning,
+	}
+	m.logger.Info("Watching server", "server_id", serverID, "container_id", serverData.ContainerID)
+	return nil
+}
+
+// Unwatch stops watching a server and reports whether it was watched.
+// The worker calls it before stopping or removing a server, so the exit is not reported as a crash.
+func (m *Monitor) Unwatch(serverID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.servers[serverID]
+	delete(m.servers, serverID)
+	return ok
+}
+
+// Run watches the servers until ctx is done.
+func (m *Monitor) Run(ctx context.Context) {
+	go m.followEvents(ctx)
+
+	interval := time.Duration(config.WorkerEnvs.BuilderConfig.MonitorInterval) * time.Second
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	m.logger.Info("Monitor started", "probe_interval", interval)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.probeServers(ctx)
+		}
+	}
+}
+
+// followEvents handles the events of the server containers, subscribing again when the stream fails.
+func (m *Monitor) followEvents(ctx context.Context) {
+	options := events.ListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("type", string(events.ContainerEventType)),
+			filters.Arg("label", serverIDLabel),
+			filters.Arg("event", string(events.ActionStart)),
+			filters.Arg("event", string(events.ActionKill)),
+			filters.Arg("event", string(events.ActionStop)),
+			filters.Arg("event", string(events.ActionOOM)),
+			filters.Arg("event", string(events.ActionDie)),
+			filters.Arg("event", string(events.ActionDestroy)),
+			filters.Arg("event", string(events.ActionHealthStatus)),
+		),
+	}
+
+	for {
+		messages, errs := m.runtime.Events(ctx, options)
+		err := m.handleEvents(ctx, messages, errs)
+		if ctx.Err() != nil {
+			return
+		}
+
+		m.logger.Warn("Docker event stream failed, subscribing again", "error", err, "retry_in", eventsRetryInterval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(eventsRetryInterval):
+		}
+		// The exits missed while the stream was down are found by inspecting the containers
+		m.probeServers(ctx)
+	}
+}
+
+func (m *Monitor) handleEvents(ctx context.Context, messages <-chan events.Message, errs <-chan error) error {
+	for {
+		select {
+		case message := <-messages:
+			m.handleEvent(ctx, message)
+		case err := <-errs:
+			return err
+		}
+	}
+}
+
+func (m *Monitor) handleEvent(ctx context.Context, message events.Message) {
+	serverID := message.Actor.Attributes[serverIDLabel]
+
+	m.mu.Lock()
+	server, ok := m.servers[serverID]
+	if !ok || server.containerID != message.Actor.ID {
+		m.mu.Unlock()
+		return
+	}
+	m.logger.Debug("Container event", "server_id", serverID, "action", message.Action)
+
+	var changed bool
+	switch message.Action {
+	case events.ActionOOM:
+		server.oomKilled = true
+	case events.ActionStop, events.ActionKill:
+		server.stopRequested = true
+	case events.ActionStart:
+		server.failedProbes = 0
+		server.stopRequested = false
+	case events.ActionHealthStatusUnhealthy:
+		changed = setStatus(server, StatusUnhealthy)
+	case events.ActionHealthStatusHealthy:
+		if server.status == StatusUnhealthy {
+			changed = setStatus(server, StatusRunning)
+		}
+	}
+	containerID := server.containerID
+	m.mu.Unlock()
+
+	switch {
+	case changed && message.Action == events.ActionHealthStatusUnhealthy:
+		m.report(serverID, containerID, StatusUnhealthy, "Server failed its Docker health check", nil)
+	case changed:
+		m.report(serverID, containerID, StatusRunning, "Server passes its Docker health check again", nil)
+	case message.Action == events.ActionDie || message.Action == events.ActionDestroy:
+		m.handleExit(ctx, serverID, containerID)
+	}
+}
+
+// setStatus changes the status of a server and reports whether it changed.
+func setStatus(server *monitoredServer, status string) bool {
+	if server.status == status {
+		return false
+	}
+	server.status = status
+	return true
+}
+
+// probeServers sends a Server List Ping to every watched server.
+// Servers not answering are inspected, to tell a hung server from an exit missed by the event stream.
+func (m *Monitor) probeServers(ctx context.Context) {
+	m.mu.Lock()
+	servers := make(map[string]monitoredServer, len(m.servers))
+	for serverID, server := range m.servers {
+		servers[serverID] = *server
+	}
+	m.mu.Unlock()
+
+	for serverID, server := range servers {
+		if ctx.Err() != nil {
+			return
+		}
+		m.probeServer(ctx, serverID, server)
+	}
+}
+
+func (m *Monitor) probeServer(ctx context.Context, serverID string, server monitoredServer) {
+	probeAddress := net.JoinHostPort(config.WorkerEnvs.ProbeHost, strconv.Itoa(int(server.port)))
+	if server.port != 0 {
+		if _, err := m.healthChecker.probe(ctx, probeAddress); err == nil {
+			m.mu.Lock()
+			current, ok := m.servers[serverID]
+			changed := ok && current.containerID == server.containerID && setStatus(current, StatusRunning)
+			if ok {
+				current.failedProbes = 0
+			}
+			m.mu.Unlock()
+
+			if changed {
+				m.report(serverID, server.containerID, StatusRunning, "Server answers the server list ping again", nil)
+			}
+			return
+		}
+	}
+
+	inspect, err := m.runtime.ContainerInspect(ctx, server.containerID)
+	if err != nil && !cerrdefs.IsNotFound(err) {
+		m.logger.Warn("Failed to inspect server", "server_id", serverID, "error", err)
+		return
+	}
+	if err != nil || !isUp(inspect.State) {
+		m.handleExit(ctx, serverID, server.containerID)
+		return
+	}
+	if server.port == 0 {
+		return
+	}
+
+	m.mu.Lock()
+	current, ok := m.servers[serverID]
+	var changed bool
+	if ok && current.containerID == server.containerID {
+		current.failedProbes++
+		// A crashed server stays crashed until it answers again
+		if current.failedProbes >= unhealthyAfter && current.status == StatusRunning {
+			changed = setStatus(current, StatusUnhealthy)
+		}
+	}
+	m.mu.Unlock()
+
+	if changed {
+		m.logger.Warn("Server does not answer the server list ping", "server_id", serverID, "address", probeAddress, "failed_probes", unhealthyAfter)
+		m.report(serverID, server.containerID, StatusUnhealthy,
+			fmt.Sprintf("Server did not answer the last %d server list pings", unhealthyAfter), nil)
+	}
+}
+
+// isUp reports whether a container is running, or about to run again as Docker restarts it.
+func isUp(state *container.State) bool {
+	return state != nil && (state.Running || state.Restarting)
+}
+
+// handleExit reports the exit of a server container. A server Docker restarts stays watched as crashed,
+// a server that exited for good is no longer watched and onDown is called.
+func (m *Monitor) handleExit(ctx context.Context, serverID string, containerID string) {
+	inspect, err := m.runtime.ContainerInspect(ctx, containerID)
+	if err != nil && !cerrdefs.IsNotFound(err) {
+		m.logger.Warn("Failed to inspect exited server", "server_id", serverID, "error", err)
+		return
+	}
+	var state *container.State
+	if err == nil {
+		state = inspect.State
+	}
+
+	m.mu.Lock()
+	server, ok := m.servers[serverID]
+	if !ok || server.containerID != containerID {
+		// Unwatched meanwhile, or already handled
+		m.mu.Unlock()
+		return
+	}
+	oomKilled := server.oomKilled || (state != nil && state.OOMKilled)
+	stopRequested := server.stopRequested
+	restarting := isUp(state)
+	if restarting {
+		if !setStatus(server, StatusCrashed) {
+			m.mu.Unlock()
+			return // Still crash looping, the crash is already reported
+		}
+		server.failedProbes = 0
+		server.oomKilled = false
+	} else {
+		delete(m.servers, serverID)
+	}
+	m.mu.Unlock()
+
+	switch {
+	case restarting:
+		m.logger.Warn("Server crashed, Docker is restarting it", "server_id", serverID, "exit_code", state.ExitCode)
+		m.report(serverID, containerID, StatusCrashed, "Server crashed, restarting it", m.crashFields(ctx, containerID, state.ExitCode, oomKilled))
+	case state == nil:
+		m.logger.Warn("Server container was removed", "server_id", serverID)
+		m.report(serverID, containerID, StatusStopped, "Server container was removed", nil)
+	case oomKilled || (state.ExitCode != 0 && !stopRequested):
+		m.logger.Warn("Server crashed", "server_id", serverID, "exit_code", state.ExitCode, "oom_killed", oomKilled)
+		m.report(serverID, containerID, StatusCrashed, "Server crashed", m.crashFields(ctx, containerID, state.ExitCode, oomKilled))
+	default:
+		m.logger.Info("Server stopped outside of the worker", "server_id", serverID, "exit_code", state.ExitCode)
+		m.report(serverID, containerID, StatusStopped, "Server stopped", map[string]string{"exit_code": strconv.Itoa(state.ExitCode)})
+	}
+
+	if !restarting && m.onDown != nil {
+		m.onDown(serverID)
+	}
+}
+
+// crashFields returns the exit code of a crashed server with the cause found in its last log lines,
+// the same fields as a failed startup.
+func (m *Monitor) crashFields(ctx context.Context, containerID string, exitCode int, oomKilled bool) map[string]string {
+	ctx, cancel := context.WithTimeout(ctx, diagnoseTimeout)
+	defer cancel()
+
+	lines, err := m.healthChecker.tailLogs(ctx, containerID, time.Time{}, int(config.WorkerEnvs.BuilderConfig.FailureLogLines))
+	if err != nil {
+		m.logger.Warn("Failed to read the logs of the crashed server", "container_id", containerID, "error", err)
+	}
+	category, explanation, ok := classifyFailure(lines, oomKilled)
+	if !ok {
+		category = FailureCrashed
+		explanation = fmt.Sprintf("The server stopped with exit code %d, see the last log lines.", exitCode)
+	}
+	return map[string]string{
+		"exit_code":   strconv.Itoa(exitCode),
+		"category":    string(category),
+		"explanation": explanation,
+		"logs":        strings.Join(lines, "\n"),
+	}
+}
+
+// report publishes a status change of a server.
+func (m *Monitor) report(serverID string, containerID string, status string, message string, fields map[string]string) {
+	event := map[string]string{
+		"message":      message,
+		"status":       status,
+		"stage":        "monitoring",
+		"server_id":    serverID,
+		"container_id": containerID,
+	}
+	maps.Copy(event, fields)
+	m.producer.SendJsonMessage("server.status.changed", event)
+}
@@ -0,0 +1,262 @@
+package builder
+
+import (
+	"beelder/internal/worker/builder/fakeruntime"
+	"beelder/pkg/messaging/memory"
+	"context"
+	"encoding/json"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// statusTopic is the topic the test monitors publish their events to.
+const statusTopic = "status"
+
+// monitorTimeout is how long the tests wait for the monitor to handle a container event.
+const monitorTimeout = 2 * time.Second
+
+// monitoredTestServer is a server built by a test builder and watched by a running monitor.
+// Its monitor never probes on its own, the tests call probeServers.
+type monitoredTestServer struct {
+	monitor     *Monitor
+	runtime     *fakeruntime.Runtime
+	bus         *memory.Bus
+	containerID string
+	downs       atomic.Int32
+}
+
+func startMonitoredServer(t *testing.T) *monitoredTestServer {
+	t.Helper()
+
+	b, runtime, bus := newTestBuilder(t)
+	runtime.DefaultScript(fakeruntime.Script{
+		Logs: []fakeruntime.LogLine{
+			{After: 10 * time.Millisecond, Text: "[Server thread/INFO]: Done (0.1s)! For help, type \"help\""},
+			{After: 20 * time.Millisecond, Text: "[Server thread/WARN]: Can't keep up! Is the server overloaded?"},
+		},
+	})
+	serverData := newTestServerData()
+	if err, stage := b.BuildServer(context.Background(), serverData); err != nil {
+		t.Fatalf("BuildServer failed at %s: %v", stage, err)
+	}
+
+	server := &monitoredTestServer{runtime: runtime, bus: bus, containerID: serverData.ContainerID}
+	server.monitor = NewMonitor(bus.Publisher(statusTopic), runtime, func(serverID string) {
+		if serverID == serverData.ServerID {
+			server.downs.Add(1)
+		}
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if err := server.monitor.Watch(ctx, serverData.ServerID); err != nil {
+		t.Fatal(err)
+	}
+
+	// The events sent before the monitor subscribes would be lost
+	subscribed := slices.Contains(runtime.Calls(), "Events")
+	go server.monitor.Run(ctx)
+	for deadline := time.Now().Add(monitorTimeout); !subscribed; subscribed = slices.Contains(runtime.Calls(), "Events") {
+		if time.Now().After(deadline) {
+			t.Fatal("the monitor did not subscribe to the Docker events")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return server
+}
+
+// statusEvents returns the fields of the events the monitor published.
+func statusEvents(t *testing.T, bus *memory.Bus) []map[string]string {
+	t.Helper()
+
+	var published []map[string]string
+	for _, message := range bus.Messages(statusTopic) {
+		if string(message.Key) != "server.status.changed" {
+			t.Errorf("event %s published, want server.status.changed", message.Key)
+		}
+		var fields map[string]string
+		if err := json.Unmarshal(message.Value, &fields); err != nil {
+			t.Fatalf("event %s is not a string map: %v", message.Key, err)
+		}
+		published = append(published, fields)
+	}
+	return published
+}
+
+// waitForStatusEvents waits until the monitor published n events and returns them.
+// It waits a little longer to catch the events published past n.
+func waitForStatusEvents(t *testing.T, bus *memory.Bus, n int) []map[string]string {
+	t.Helper()
+
+	for deadline := time.Now().Add(monitorTimeout); len(bus.Messages(statusTopic)) < n; {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d status events published within %v, want %d: %v", len(bus.Messages(statusTopic)), monitorTimeout, n, statusEvents(t, bus))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	return statusEvents(t, bus)
+}
+
+func TestMonitorReportsExits(t *testing.T) {
+	tests := []struct {
+		name         string
+		exit         func(ctx context.Context, runtime *fakeruntime.Runtime, containerID string) error
+		wantStatus   string
+		wantCategory FailureCategory
+		wantExitCode string
+	}{
+		{
+			name: "crash",
+			exit: func(ctx context.Context, runtime *fakeruntime.Runtime, containerID string) error {
+				return runtime.Crash(containerID, 1, false)
+			},
+			wantStatus:   StatusCrashed,
+			wantCategory: FailureCrashed,
+			wantExitCode: "1",
+		},
+		{
+			name: "out of memory",
+			exit: func(ctx context.Context, runtime *fakeruntime.Runtime, containerID string) error {
+				return runtime.Crash(containerID, 137, true)
+			},
+			wantStatus:   StatusCrashed,
+			wantCategory: FailureOutOfMemory,
+			wantExitCode: "137",
+		},
+		{
+			// A docker stop kills the server, it did not crash
+			name: "stop outside of the worker",
+			exit: func(ctx context.Context, runtime *fakeruntime.Runtime, containerID string) error {
+				return runtime.ContainerStop(ctx, containerID, container.StopOptions{})
+			},
+			wantStatus:   StatusStopped,
+			wantExitCode: "0",
+		},
+		{
+			name: "kill outside of the worker",
+			exit: func(ctx context.Context, runtime *fakeruntime.Runtime, containerID string) error {
+				return runtime.ContainerKill(ctx, containerID, "SIGKILL")
+			},
+			wantStatus:   StatusStopped,
+			wantExitCode: "137",
+		},
+		{
+			name: "container removed",
+			exit: func(ctx context.Context, runtime *fakeruntime.Runtime, containerID string) error {
+				return runtime.ContainerRemove(ctx, containerID, container.RemoveOptions{Force: true})
+			},
+			wantStatus: StatusStopped,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startMonitoredServer(t)
+			ctx := context.Background()
+			if err := tt.exit(ctx, server.runtime, server.containerID); err != nil {
+				t.Fatal(err)
+			}
+
+			published := waitForStatusEvents(t, server.bus, 1)
+			if len(published) != 1 {
+				t.Fatalf("%d status events published, want 1: %v", len(published), published)
+			}
+			event := published[0]
+			if event["status"] != tt.wantStatus || event["server_id"] != "srv-1" || event["container_id"] != server.containerID {
+				t.Errorf("event = %v, want %s for srv-1", event, tt.wantStatus)
+			}
+			if event["category"] != string(tt.wantCategory) || event["exit_code"] != tt.wantExitCode {
+				t.Errorf("event = %v, want category %q and exit code %q", event, tt.wantCategory, tt.wantExitCode)
+			}
+
+			// A later probe or event of the exited container does not release its slot again
+			server.monitor.probeServers(ctx)
+			server.runtime.ContainerRemove(ctx, server.containerID, container.RemoveOptions{Force: true})
+			if published := waitForStatusEvents(t, server.bus, 1); len(published) != 1 {
+				t.Errorf("%d status events published after the exit was handled, want 1: %v", len(published), published)
+			}
+			if downs := server.downs.Load(); downs != 1 {
+				t.Errorf("onDown called %d times, want once", downs)
+			}
+			if server.monitor.Unwatch("srv-1") {
+				t.Error("exited server still watched")
+			}
+		})
+	}
+}
+
+func TestMonitorIgnoresUnwatchedExit(t *testing.T) {
+	server := startMonitoredServer(t)
+	ctx := context.Background()
+
+	// The worker unwatches the servers it stops itself
+	if !server.monitor.Unwatch("srv-1") {
+		t.Fatal("server not watched")
+	}
+	if err := server.runtime.ContainerStop(ctx, server.containerID, container.StopOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	server.monitor.probeServers(ctx)
+
+	time.Sleep(50 * time.Millisecond)
+	if published := statusEvents(t, server.bus); len(published) != 0 {
+		t.Errorf("status events published for an unwatched server: %v", published)
+	}
+	if downs := server.downs.Load(); downs != 0 {
+		t.Errorf("onDown called %d times for an unwatched server", downs)
+	}
+}
+
+func TestMonitorReportsFailedProbes(t *testing.T) {
+	server := startMonitoredServer(t)
+	ctx := context.Background()
+
+	// Nothing answers the Server List Ping on the server port
+	for probe := 1; probe < unhealthyAfter; probe++ {
+		server.monitor.probeServers(ctx)
+		if published := statusEvents(t, server.bus); len(published) != 0 {
+			t.Fatalf("status events published after %d failed probes: %v", probe, published)
+		}
+	}
+	server.monitor.probeServers(ctx)
+	published := statusEvents(t, server.bus)
+	if len(published) != 1 || published[0]["status"] != StatusUnhealthy {
+		t.Fatalf("events = %v, want the server unhealthy after %d failed probes", published, unhealthyAfter)
+	}
+
+	// An unhealthy server is reported once, and stays watched
+	server.monitor.probeServers(ctx)
+	if published := statusEvents(t, server.bus); len(published) != 1 {
+		t.Errorf("%d status events published, want the server reported unhealthy once", len(published))
+	}
+	if downs := server.downs.Load(); downs != 0 {
+		t.Errorf("onDown called %d times for a running server", downs)
+	}
+}
+
+func TestMonitorReportsDockerHealthCheck(t *testing.T) {
+	server := startMonitoredServer(t)
+
+	if err := server.runtime.Health(server.containerID, "unhealthy"); err != nil {
+		t.Fatal(err)
+	}
+	published := waitForStatusEvents(t, server.bus, 1)
+	if len(published) != 1 || published[0]["status"] != StatusUnhealthy {
+		t.Fatalf("events = %v, want the server unhealthy", published)
+	}
+
+	if err := server.runtime.Health(server.containerID, "healthy"); err != nil {
+		t.Fatal(err)
+	}
+	published = waitForStatusEvents(t, server.bus, 2)
+	if len(published) != 2 || published[1]["status"] != StatusRunning {
+		t.Fatalf("events = %v, want the server running again", published)
+	}
+	if downs := server.downs.Load(); downs != 0 {
+		t.Errorf("onDown called %d times for a running server", downs)
+	}
+}
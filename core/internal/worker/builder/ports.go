@@ -0,0 +1,127 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// ErrNoPortsAvailable is returned when every port of the allocator range is in use.
+var ErrNoPortsAvailable = errors.New("no ports available")
+
+// PortAllocator hands out host ports from a fixed range and reclaims them when servers are destroyed.
+type PortAllocator struct {
+	mu       sync.Mutex
+	minPort  int32
+	maxPort  int32
+	byPort   map[int32]string
+	byServer map[string]int32
+}
+
+// NewPortAllocator creates an allocator for the inclusive range [minPort, maxPort].
+func NewPortAllocator(minPort int32, maxPort int32) *PortAllocator {
+	return &PortAllocator{
+		minPort:  minPort,
+		maxPort:  maxPort,
+		byPort:   make(map[int32]string),
+		byServer: make(map[string]int32),
+	}
+}
+
+// Allocate returns the lowest free port and assigns it to the server.
+// A server that already holds a port gets the same one back.
+func (p *PortAllocator) Allocate(serverID string) (int32, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if port, ok := p.byServer[serverID]; ok {
+		return port, nil
+	}
+
+	for port := p.minPort; port <= p.maxPort; port++ {
+		if _, used := p.byPort[port]; !used {
+			p.byPort[port] = serverID
+			p.byServer[serverID] = port
+			return port, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w in range %d-%d", ErrNoPortsAvailable, p.minPort, p.maxPort)
+}
+
+// Reserve marks a port as used by a server, it is used to restore existing containers.
+// Ports outside of the range are tracked too so they are never handed out twice.
+func (p *PortAllocator) Reserve(serverID string, port int32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.byPort[port] = serverID
+	p.byServer[serverID] = port
+}
+
+// Release frees the port held by a server, if any.
+func (p *PortAllocator) Release(serverID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if port, ok := p.byServer[serverID]; ok {
+		delete(p.byPort, port)
+		delete(p.byServer, serverID)
+	}
+}
+
+// Restore rebuilds the allocator state from the host ports bound by existing ms-* containers,
+// running or not, so ports are not reused after a worker restart.
+func (p *PortAllocator) Restore(ctx context.Context, runtime ContainerRuntime) error {
+	containers, err := runtime.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("name", "ms-")),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list server containers: %w", err)
+	}
+
+	for _, serverContainer := range containers {
+		if !hasServerContainerName(serverContainer.Names) {
+			continue
+		}
+
+		// Stopped containers do not report their ports in the summary, the host config keeps them
+		inspect, err := runtime.ContainerInspect(ctx, serverContainer.ID)
+		if err != nil {
+			return fmt.Errorf("failed to inspect container %s: %w", serverContainer.ID[:12], err)
+		}
+
+		serverID := serverContainer.Labels[serverIDLabel]
+		if serverID == "" {
+			serverID = serverContainer.ID
+		}
+		for _, bindings := range inspect.HostConfig.PortBindings {
+			for _, binding := range bindings {
+				port, err := strconv.ParseInt(binding.HostPort, 10, 32)
+				if err != nil {
+					continue
+				}
+				p.Reserve(serverID, int32(port))
+			}
+		}
+	}
+
+	return nil
+}
+
+// hasServerContainerName reports whether one of the container names has the ms- prefix used by the builder.
+func hasServerContainerName(names []string) bool {
+	for _, name := range names {
+		if strings.HasPrefix(strings.TrimPrefix(name, "/"), "ms-") {
+			return true
+		}
+	}
+	return false
+}
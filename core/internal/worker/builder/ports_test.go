@@ -0,0 +1,139 @@
+package builder
+
+import (
+	"beelder/internal/worker/builder/fakeruntime"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+)
+
+func TestPortAllocator(t *testing.T) {
+	ports := NewPortAllocator(45000, 45002)
+
+	// allocate checks the port handed out to a server
+	allocate := func(serverID string, want int32) {
+		t.Helper()
+		port, err := ports.Allocate(serverID)
+		if err != nil {
+			t.Fatalf("Allocate(%s) failed: %v", serverID, err)
+		}
+		if port != want {
+			t.Errorf("Allocate(%s) = %d, want %d", serverID, port, want)
+		}
+	}
+
+	allocate("srv-1", 45000)
+	allocate("srv-2", 45001)
+	allocate("srv-3", 45002)
+	// A server keeps its port
+	allocate("srv-1", 45000)
+
+	if port, err := ports.Allocate("srv-4"); !errors.Is(err, ErrNoPortsAvailable) {
+		t.Fatalf("Allocate(srv-4) = %d, %v, want ErrNoPortsAvailable once the range is used", port, err)
+	}
+
+	// The lowest released port is handed out first
+	ports.Release("srv-2")
+	ports.Release("unknown")
+	allocate("srv-4", 45001)
+
+	// Reserved ports are never handed out, in the range or not
+	ports.Release("srv-3")
+	ports.Reserve("srv-5", 45002)
+	ports.Reserve("srv-6", 25565)
+	if port, err := ports.Allocate("srv-7"); !errors.Is(err, ErrNoPortsAvailable) {
+		t.Errorf("Allocate(srv-7) = %d, %v, want the reserved port kept", port, err)
+	}
+}
+
+func TestBuildServerReportsNoPortsAvailable(t *testing.T) {
+	b, runtime, _ := newTestBuilder(t)
+	b.ports = NewPortAllocator(45000, 45000)
+	runtime.DefaultScript(fakeruntime.Script{
+		Logs: []fakeruntime.LogLine{{After: 10 * time.Millisecond, Text: "[Server thread/INFO]: Done (0.1s)! For help, type \"help\""}},
+	})
+	ctx := context.Background()
+
+	first := newTestServerData()
+	if err, stage := b.BuildServer(ctx, first); err != nil {
+		t.Fatalf("BuildServer failed at %s: %v", stage, err)
+	}
+
+	second := newTestServerData()
+	second.ServerID = "srv-2"
+	err, stage := b.BuildServer(ctx, second)
+	if !errors.Is(err, ErrNoPortsAvailable) || stage != "allocating_port" {
+		t.Fatalf("BuildServer() = %v at %s, want ErrNoPortsAvailable at allocating_port", err, stage)
+	}
+	containers, err := runtime.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 1 {
+		t.Errorf("%d containers, want only the first server", len(containers))
+	}
+
+	// Destroying the first server frees its port
+	if err := b.DestroyServer(ctx, first.ServerID, first.ContainerID, true); err != nil {
+		t.Fatal(err)
+	}
+	if err, stage := b.BuildServer(ctx, second); err != nil {
+		t.Fatalf("BuildServer failed at %s after the port was released: %v", stage, err)
+	}
+	if second.Port != 45000 {
+		t.Errorf("port = %d, want the released port 45000", second.Port)
+	}
+}
+
+func TestPortAllocatorRestore(t *testing.T) {
+	b, runtime, bus := newTestBuilder(t)
+	runtime.DefaultScript(fakeruntime.Script{
+		Logs: []fakeruntime.LogLine{{After: 10 * time.Millisecond, Text: "[Server thread/INFO]: Done (0.1s)! For help, type \"help\""}},
+	})
+	ctx := context.Background()
+
+	var servers []string
+	for _, serverID := range []string{"srv-1", "srv-2"} {
+		serverData := newTestServerData()
+		serverData.ServerID = serverID
+		if err, stage := b.BuildServer(ctx, serverData); err != nil {
+			t.Fatalf("BuildServer(%s) failed at %s: %v", serverID, stage, err)
+		}
+		servers = append(servers, serverData.ContainerID)
+	}
+	// Stopped servers keep their port
+	if err := runtime.ContainerStop(ctx, servers[1], container.StopOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Containers of older workers have no labels, only their ms- name
+	runtime.AddImage("legacy-image")
+	for name, port := range map[string]string{"ms-vanilla-2GB-legacy": "45002", "proxy": "45003"} {
+		_, err := runtime.ContainerCreate(ctx, &container.Config{Image: "legacy-image"}, &container.HostConfig{
+			PortBindings: nat.PortMap{"25565/tcp": []nat.PortBinding{{HostIP: "0.0.0.0", HostPort: port}}},
+		}, nil, nil, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A restarted worker starts from an empty allocator
+	restarted := NewBuilder(bus.Publisher(progressTopic), runtime, b.serverTypes, b.plans)
+	if err := restarted.ports.Restore(ctx, runtime); err != nil {
+		t.Fatal(err)
+	}
+
+	for serverID, want := range map[string]int32{"srv-1": 45000, "srv-2": 45001, "srv-3": 45003} {
+		port, err := restarted.ports.Allocate(serverID)
+		if err != nil {
+			t.Fatalf("Allocate(%s) failed: %v", serverID, err)
+		}
+		if port != want {
+			t.Errorf("Allocate(%s) = %d, want %d", serverID, port, want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package builder
+
+import (
+	"beelder/internal/types"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	// ServerPropertiesPath is where server.properties is written inside the container.
+	ServerPropertiesPath = "/server"
+	serverPropertiesFile = "server.properties"
+	containerServerPort  = 25565
+	// worldName is the world directory, backed by the "world" volume of the server
+	worldName = "world"
+)
+
+// ServerProperties holds the server.properties values derived from a CreateServerConfig.
+type ServerProperties struct {
+	Difficulty string
+	Hardcore   bool
+	OnlineMode bool
+	MaxPlayers int
+	Motd       string
+	LevelName  string
+	ServerPort int
+}
+
+// NewServerProperties maps the user facing server config to server.properties values.
+// "hardcore" is not a Minecraft difficulty, it is played on hard with the hardcore flag set.
+func NewServerProperties(config *types.CreateServerConfig) *ServerProperties {
+	difficulty := strings.ToLower(config.Difficulty)
+	hardcore := difficulty == "hardcore"
+	if hardcore {
+		difficulty = "hard"
+	}
+	if difficulty == "" {
+		difficulty = "easy"
+	}
+
+	return &ServerProperties{
+		Difficulty: difficulty,
+		Hardcore:   hardcore,
+		OnlineMode: config.OnlineMode,
+		MaxPlayers: config.PlayerCount,
+		Motd:       config.Name,
+		LevelName:  worldName,
+		ServerPort: containerServerPort,
+	}
+}
+
+// Render returns the server.properties file content.
+// Keys are written in a fixed order so the output is stable between builds.
+func (p *ServerProperties) Render() string {
+	var sb strings.Builder
+	sb.WriteString("# Minecraft server properties generated by beelder\n")
+	fmt.Fprintf(&sb, "difficulty=%s\n", p.Difficulty)
+	fmt.Fprintf(&sb, "hardcore=%t\n", p.Hardcore)
+	fmt.Fprintf(&sb, "level-name=%s\n", escapePropertyValue(p.LevelName))
+	fmt.Fprintf(&sb, "max-players=%d\n", p.MaxPlayers)
+	fmt.Fprintf(&sb, "motd=%s\n", escapePropertyValue(p.Motd))
+	fmt.Fprintf(&sb, "online-mode=%t\n", p.OnlineMode)
+	fmt.Fprintf(&sb, "server-port=%d\n", p.ServerPort)
+	return sb.String()
+}
+
+// escapePropertyValue escapes a value following the java.util.Properties format,
+// non ASCII characters are written as \uXXXX so the file is valid in any encoding.
+// A leading space is escaped too, Properties would otherwise strip it.
+func escapePropertyValue(value string) string {
+	var sb strings.Builder
+	for i, r := range value {
+		switch {
+		case r == ' ' && i == 0:
+			sb.WriteString(`\ `)
+		case r == '\\':
+			sb.WriteString(`\\`)
+		case r == '\n':
+			sb.WriteString(`\n`)
+		case r == '\r':
+			sb.WriteString(`\r`)
+		case r == '\t':
+			sb.WriteString(`\t`)
+		case r == '=' || r == ':' || r == '#' || r == '!':
+			sb.WriteRune('\\')
+			sb.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			for _, unit := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(&sb, `\u%04x`, unit)
+			}
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,94 @@
+package builder
+
+import (
+	"beelder/internal/types"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata with the current output")
+
+func TestServerPropertiesGolden(t *testing.T) {
+	// server.properties does not depend on the server type, each case varies the values it is named after
+	tests := []struct {
+		name   string
+		config types.CreateServerConfig
+	}{
+		{
+			name:   "hardcore",
+			config: types.CreateServerConfig{Name: "Vanilla Hardcore", Difficulty: "hardcore", OnlineMode: true, PlayerCount: 10},
+		},
+		{
+			name:   "escaped-separators",
+			config: types.CreateServerConfig{Name: `Server: #1 = best! C:\worlds`, Difficulty: "normal", OnlineMode: true, PlayerCount: 50},
+		},
+		{
+			name:   "non-ascii-name",
+			config: types.CreateServerConfig{Name: "Café ☕ 🎮", Difficulty: "peaceful", PlayerCount: 20},
+		},
+		{
+			name:   "leading-whitespace",
+			config: types.CreateServerConfig{Name: "  Leading spaces\tand a tab", Difficulty: "easy", PlayerCount: 5},
+		},
+		{
+			name:   "uppercase-difficulty",
+			config: types.CreateServerConfig{Name: "Hard Server", Difficulty: "HARD", OnlineMode: true, PlayerCount: 8},
+		},
+		{
+			name:   "multiline-name",
+			config: types.CreateServerConfig{Name: "First line\nSecond line\r", Difficulty: "normal", PlayerCount: 30},
+		},
+		{
+			name:   "default-difficulty",
+			config: types.CreateServerConfig{Name: "Default Difficulty", PlayerCount: 100},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverConfig := tt.config
+			got := NewServerProperties(&serverConfig).Render()
+
+			golden := filepath.Join("testdata", tt.name+".properties")
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("server.properties differs from %s\ngot:\n%s\nwant:\n%s", golden, got, want)
+			}
+		})
+	}
+}
+
+func TestEscapePropertyValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"My Server", "My Server"},
+		{"", ""},
+		{"a=b:c#d!e", `a\=b\:c\#d\!e`},
+		{`C:\worlds`, `C\:\\worlds`},
+		{" leading", `\ leading`},
+		{"trailing ", "trailing "},
+		{"tab\tnew\nline\r", `tab\tnew\nline\r`},
+		{"\x01bell\x07", `\u0001bell\u0007`},
+		{"Café", `Caf\u00e9`},
+		// Characters outside of the BMP are written as a UTF-16 surrogate pair
+		{"🎮", `\ud83c\udfae`},
+	}
+
+	for _, tt := range tests {
+		if got := escapePropertyValue(tt.value); got != tt.want {
+			t.Errorf("escapePropertyValue(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package builder
+
+import (
+	"beelder/internal/types"
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// ReconciledServer is a server found on the Docker host when the worker starts.
+type ReconciledServer struct {
+	ServerData *types.CreateServerData
+	Running    bool
+}
+
+// Reconcile rebuilds the builder state from the containers that already exist on the Docker host.
+// It restores the allocated ports and returns every labeled server container with its running state,
+// so the worker can rebuild its live server count and report them.
+// It must be called before the first build after a worker restart.
+func (b *Builder) Reconcile(ctx context.Context) ([]ReconciledServer, error) {
+	// Unlabeled ms-* containers from older workers still hold their ports
+	if err := b.ports.Restore(ctx, b.runtime); err != nil {
+		return nil, err
+	}
+
+	containers, err := b.runtime.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: labeledServersFilter(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list server containers: %w", err)
+	}
+
+	servers := make([]ReconciledServer, 0, len(containers))
+	for _, serverContainer := range containers {
+		serverData := serverFromLabels(serverContainer.ID, serverContainer.Image, serverContainer.Labels)
+		if serverData.Port != 0 {
+			b.ports.Reserve(serverData.ServerID, serverData.Port)
+		}
+
+		running := serverContainer.State == container.StateRunning || serverContainer.State == container.StateRestarting
+		b.logger.Info("Reconciled server container",
+			"server_id", serverData.ServerID,
+			"container_id", serverContainer.ID,
+			"state", serverContainer.State,
+			"port", serverData.Port,
+		)
+		servers = append(servers, ReconciledServer{
+			ServerData: serverData,
+			Running:    running,
+		})
+	}
+
+	return servers, nil
+}
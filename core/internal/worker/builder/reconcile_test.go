@@ -0,0 +1,64 @@
+package builder
+
+import (
+	"beelder/internal/worker/builder/fakeruntime"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestReconcile(t *testing.T) {
+	b, runtime, bus := newTestBuilder(t)
+	runtime.DefaultScript(fakeruntime.Script{
+		Logs: []fakeruntime.LogLine{{After: 10 * time.Millisecond, Text: "[Server thread/INFO]: Done (0.1s)! For help, type \"help\""}},
+	})
+	ctx := context.Background()
+
+	built := map[string]string{}
+	for _, serverID := range []string{"srv-1", "srv-2"} {
+		serverData := newTestServerData()
+		serverData.ServerID = serverID
+		if err, stage := b.BuildServer(ctx, serverData); err != nil {
+			t.Fatalf("BuildServer(%s) failed at %s: %v", serverID, stage, err)
+		}
+		built[serverID] = serverData.ContainerID
+	}
+	if err := runtime.Crash(built["srv-2"], 1, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restarted worker starts from an empty builder
+	restarted := NewBuilder(bus.Publisher(progressTopic), runtime, b.serverTypes, b.plans)
+	servers, err := restarted.Reconcile(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(servers) != 2 {
+		t.Fatalf("%d servers reconciled, want 2", len(servers))
+	}
+	wantPorts := map[string]int32{"srv-1": 45000, "srv-2": 45001}
+	for _, server := range servers {
+		serverData := server.ServerData
+		if serverData.ContainerID != built[serverData.ServerID] || serverData.Port != wantPorts[serverData.ServerID] {
+			t.Errorf("reconciled %s with container %s on port %d, want container %s on port %d",
+				serverData.ServerID, serverData.ContainerID, serverData.Port, built[serverData.ServerID], wantPorts[serverData.ServerID])
+		}
+		if serverData.ServerConfig.ServerType != "vanilla" || serverData.ServerConfig.ServerVersion != "1.21.1" || serverData.ServerConfig.RamPlan != "2GB" {
+			t.Errorf("reconciled %s with config %+v, want the config it was built with", serverData.ServerID, serverData.ServerConfig)
+		}
+		// The exited server keeps its container, its port and its volumes
+		if wantRunning := serverData.ServerID == "srv-1"; server.Running != wantRunning {
+			t.Errorf("%s running = %v, want %v", serverData.ServerID, server.Running, wantRunning)
+		}
+	}
+
+	// The ports of both servers are taken
+	port, err := restarted.ports.Allocate("srv-3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port != 45002 {
+		t.Errorf("Allocate(srv-3) = %d, want 45002 after the reconciled ports", port)
+	}
+}
@@ -1,15 +1,17 @@
 package builder
 
 import (
+	"beelder/internal/plans"
+	"beelder/internal/servertypes"
 	"beelder/internal/types"
 	"fmt"
-	"strings"
 )
 
 // BuildStrategy defines how to build different server types
 type BuildStrategy interface {
-	GenerateDockerfile(config *types.CreateServerConfig) string
+	GetDockerfileSpec(config *types.CreateServerConfig) *DockerfileSpec
 	GetResourceSettings() *ResourceSettings
+	GetLogPatterns() servertypes.LogPatterns
 }
 
 // ResourceSettings holds the resource configuration for a plan
@@ -18,94 +20,123 @@ type ResourceSettings struct {
 	MemoryMax   string
 	MemoryLimit int64
 	CPULimit    int64
+	// JVMProfile is the name of the JVM flag profile of the plan
+	JVMProfile string
+	// JVMArgs is the full list of JVM arguments, memory flags first
+	JVMArgs []string
 }
 const (
 	OneMB = 1024 * 1024
 )
 
-// GetResourceSettings returns resource settings based on RAM plan (e.g., "1GB", "2GB", "8GB")
-func GetResourceSettings(ramPlan string, serverType string) *ResourceSettings {
-	// Parse RAM amount from plan (e.g., "8GB" -> 8)
-	var ramGB int
-	fmt.Sscanf(ramPlan, "%dGB", &ramGB)
-	if ramGB == 0 {
-		ramGB = 1 // Default to 1GB if parsing fails
-	}
-
-	// Calculate memory settings
-	// Memory limit = chosen RAM / 4 (for demo/VPS constraints), minimum 1GB
-	memoryLimitMB := max(int64(ramGB / 4 * 1024), 1024)
-	memoryLimit := memoryLimitMB * OneMB
-
-	// Max = limit - 512MB, minimum 1GB
-	memoryMaxMB := max(memoryLimitMB-512, 768)
-
-	// Min = max - 512MB, minimum 512MB
-	memoryMinMB := max(memoryMaxMB-512, 512)
+// GetResourceSettings returns the resource settings of a plan of the catalog
+// The JVM arguments use the flag profile selected for the plan or server type, when the Java runtime supports it.
+func GetResourceSettings(plan *plans.Plan, serverType string, java JavaRuntime) *ResourceSettings {
+	profile := jvmProfileFor(plan.Name, serverType, java)
 
 	return &ResourceSettings{
-		MemoryMin:   fmt.Sprintf("%dM", memoryMinMB),
-		MemoryMax:   fmt.Sprintf("%dM", memoryMaxMB),
-		MemoryLimit: memoryLimit,
-		CPULimit:    1e9, // Always 1 CPU core
+		MemoryMin:   fmt.Sprintf("%dM", plan.HeapMinMB),
+		MemoryMax:   fmt.Sprintf("%dM", plan.HeapMaxMB),
+		MemoryLimit: plan.MemoryLimitMB * OneMB,
+		CPULimit:    plan.NanoCPUs(),
+		JVMProfile:  profile.Name,
+		JVMArgs:     jvmArgs(plan.HeapMinMB, plan.HeapMaxMB, profile, java),
 	}
 }
 
-// BasicBuildStrategy for Paper/Vanilla/Fabric servers
-type BasicBuildStrategy struct {
-	config   *types.CreateServerConfig
-	settings *ResourceSettings
+// DeclarativeBuildStrategy builds any server type from its servertypes.Definition
+type DeclarativeBuildStrategy struct {
+	definition *servertypes.Definition
+	config     *types.CreateServerConfig
+	java       JavaRuntime
+	settings   *ResourceSettings
 }
 
-func NewBasicBuildStrategy(config *types.CreateServerConfig) *BasicBuildStrategy {
-	return &BasicBuildStrategy{
-		config:   config,
-		settings: GetResourceSettings(config.RamPlan, config.ServerType),
+// NewDeclarativeBuildStrategy sizes the server with plan, the plan of the catalog named by config.RamPlan.
+func NewDeclarativeBuildStrategy(definition *servertypes.Definition, plan *plans.Plan, config *types.CreateServerConfig, java JavaRuntime) *DeclarativeBuildStrategy {
+	return &DeclarativeBuildStrategy{
+		definition: definition,
+		config:     config,
+		java:       java,
+		settings:   GetResourceSettings(plan, config.ServerType, java),
 	}
 }
 
-func (s *BasicBuildStrategy) GenerateDockerfile(config *types.CreateServerConfig) string {
-	return fmt.Sprintf(BasicServerTemplate, config.ServerType, s.settings.MemoryMin, s.settings.MemoryMax)
-}
-
-func (s *BasicBuildStrategy) GetResourceSettings() *ResourceSettings {
-	return s.settings
-}
-
-// ForgeBuildStrategy for Forge servers
-type ForgeBuildStrategy struct {
-	config   *types.CreateServerConfig
-	settings *ResourceSettings
-}
+// GetDockerfileSpec copies the server artifact and the plugins, runs the install steps of the definition
+// and starts the server with its launch command.
+// The versions, memory settings and JVM arguments are exposed to the install steps and the launch command as environment variables.
+func (s *DeclarativeBuildStrategy) GetDockerfileSpec(config *types.CreateServerConfig) *DockerfileSpec {
+	spec := &DockerfileSpec{
+		ServerType:  s.definition.Name,
+		BaseImage:   s.definition.BaseImage,
+		JavaVersion: s.java.Version,
+		JavaPackage: s.java.Package,
+		Env: []EnvVar{
+			{Name: "SERVER_VERSION", Value: config.ServerVersion},
+			{Name: "LOADER_VERSION", Value: config.LoaderVersion},
+			{Name: "MEMORY_MIN", Value: s.settings.MemoryMin},
+			{Name: "MEMORY_MAX", Value: s.settings.MemoryMax},
+			{Name: "JVM_ARGS", Value: joinJVMArgs(s.settings.JVMArgs)},
+		},
+		Artifact: ContextFile{
+			Source: serverJarPath(s.definition, config.ServerVersion),
+			Target: s.definition.Artifact.CopyTo,
+		},
+		InstallSteps: s.definition.Install,
+		User:         s.definition.User,
+		DataDirs:     serverDataPaths,
+		Port:         containerServerPort,
+		// exec replaces the shell so the server receives the container signals and stdin
+		Cmd: []string{"sh", "-c", "exec " + s.definition.Launch},
+	}
 
-func NewForgeBuildStrategy(config *types.CreateServerConfig) *ForgeBuildStrategy {
-	return &ForgeBuildStrategy{
-		config:   config,
-		settings: GetResourceSettings(config.RamPlan, config.ServerType),
+	for _, plugin := range s.definition.Plugins {
+		spec.Plugins = append(spec.Plugins, ContextFile{
+			Source: pluginPath(s.definition, plugin),
+			Target: plugin,
+		})
 	}
+	return spec
 }
 
-func (s *ForgeBuildStrategy) GenerateDockerfile(config *types.CreateServerConfig) string {
-	return fmt.Sprintf(ForgeServerTemplate, config.ServerType, s.settings.MemoryMin, s.settings.MemoryMax)
+func (s *DeclarativeBuildStrategy) GetResourceSettings() *ResourceSettings {
+	return s.settings
 }
 
-func (s *ForgeBuildStrategy) GetResourceSettings() *ResourceSettings {
-	return s.settings
+func (s *DeclarativeBuildStrategy) GetLogPatterns() servertypes.LogPatterns {
+	return s.definition.LogPatterns
 }
 
 // StrategyFactory creates appropriate strategy
 type StrategyFactory interface {
-	GetStrategy(config *types.CreateServerConfig) BuildStrategy
+	GetStrategy(config *types.CreateServerConfig) (BuildStrategy, error)
 }
 
-type DefaultStrategyFactory struct{}
+// DefaultStrategyFactory creates the strategies of the server types of a registry, sized with the plans of a catalog
+type DefaultStrategyFactory struct {
+	serverTypes *servertypes.Registry
+	plans       *plans.Catalog
+}
 
-func (f *DefaultStrategyFactory) GetStrategy(config *types.CreateServerConfig) BuildStrategy {
-	serverTypeLower := strings.ToLower(config.ServerType)
-	switch {
-	case strings.Contains(serverTypeLower, "forge"):
-		return NewForgeBuildStrategy(config)
-	default:
-		return NewBasicBuildStrategy(config)
+func NewDefaultStrategyFactory(serverTypes *servertypes.Registry, plans *plans.Catalog) *DefaultStrategyFactory {
+	return &DefaultStrategyFactory{serverTypes: serverTypes, plans: plans}
+}
+
+// GetStrategy returns an error wrapping servertypes.ErrUnknownServerType when the server type has no definition,
+// plans.ErrUnknownPlan when the plan is not in the catalog,
+// or ErrUnsupportedJavaRuntime when no Java runtime can run the server version
+func (f *DefaultStrategyFactory) GetStrategy(config *types.CreateServerConfig) (BuildStrategy, error) {
+	definition, err := f.serverTypes.Lookup(config.ServerType)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := f.plans.Lookup(config.RamPlan)
+	if err != nil {
+		return nil, err
 	}
-}
\ No newline at end of file
+	java, err := resolveJavaRuntime(definition, config.ServerVersion)
+	if err != nil {
+		return nil, err
+	}
+	return NewDeclarativeBuildStrategy(definition, plan, config, java), nil
+}
@@ -0,0 +1,81 @@
+package builder
+
+import (
+	config "beelder/internal/config/worker"
+	"beelder/internal/types"
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+)
+
+const (
+	serverDataDir = "/server"
+)
+
+// serverDataPaths lists the directories under /server that hold mutable server state.
+// Each of them gets its own named volume so it survives container removal.
+var serverDataPaths = []string{
+	"world",
+	"world_nether",
+	"world_the_end",
+	"plugins",
+	"mods",
+	"config",
+}
+
+// volumeName returns the named volume used for a server data path.
+func volumeName(serverID string, dataPath string) string {
+	return fmt.Sprintf("ms-%s-%s", serverID, dataPath)
+}
+
+// shouldPurgeVolumes resolves a server volume policy, falling back to the worker default.
+func shouldPurgeVolumes(policy string) bool {
+	if policy == "" {
+		policy = config.WorkerEnvs.BuilderConfig.VolumePolicy
+	}
+	return policy == types.VolumePolicyPurge
+}
+
+// createServerVolumes creates the labeled named volumes for a server and returns the mounts for its container.
+// Volumes that already exist are reused, so a server recreated with the same ID keeps its world.
+func (b *Builder) createServerVolumes(ctx context.Context, serverID string) ([]mount.Mount, error) {
+	mounts := make([]mount.Mount, 0, len(serverDataPaths))
+	for _, dataPath := range serverDataPaths {
+		name := volumeName(serverID, dataPath)
+		if _, err := b.runtime.VolumeCreate(ctx, volume.CreateOptions{
+			Name: name,
+			Labels: map[string]string{
+				serverIDLabel: serverID,
+			},
+		}); err != nil {
+			return nil, fmt.Errorf("failed to create volume %s: %w", name, err)
+		}
+
+		mounts = append(mounts, mount.Mount{
+			Type:   mount.TypeVolume,
+			Source: name,
+			Target: path.Join(serverDataDir, dataPath),
+		})
+	}
+	return mounts, nil
+}
+
+// removeServerVolumes removes every volume labeled with the server ID.
+func (b *Builder) removeServerVolumes(ctx context.Context, serverID string) error {
+	volumes, err := b.runtime.VolumeList(ctx, volume.ListOptions{
+		Filters: serverIDFilter(serverID),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list volumes for server %s: %w", serverID, err)
+	}
+
+	for _, v := range volumes.Volumes {
+		if err := b.runtime.VolumeRemove(ctx, v.Name, true); err != nil {
+			return fmt.Errorf("failed to remove volume %s: %w", v.Name, err)
+		}
+	}
+	return nil
+}
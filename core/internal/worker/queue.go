@@ -0,0 +1,96 @@
+package worker
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrQueueFull is returned when a build cannot be queued because the queue is at capacity.
+var ErrQueueFull = errors.New("build queue is full")
+
+// BuildQueue holds create requests until a build slot and a live server slot are free.
+// Builds start in arrival order, a build counts against the live server limit
+// from the moment it starts since it becomes a live server when it succeeds.
+type BuildQueue struct {
+	mu          sync.Mutex
+	cond        *sync.Cond
+	waiting     []string
+	maxQueued   int
+	maxBuilds   int32
+	maxAlive    int32
+	running     int32
+	liveServers func() int32
+}
+
+// NewBuildQueue creates a queue holding up to maxQueued waiting builds, running at most maxBuilds at once
+// and never letting running builds plus live servers go over maxAlive.
+func NewBuildQueue(maxQueued int, maxBuilds int32, maxAlive int32, liveServers func() int32) *BuildQueue {
+	q := &BuildQueue{
+		maxQueued:   maxQueued,
+		maxBuilds:   maxBuilds,
+		maxAlive:    maxAlive,
+		liveServers: liveServers,
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// Enqueue adds a build to the queue.
+// It returns the build position, 0 when it can start right away, or ErrQueueFull.
+func (q *BuildQueue) Enqueue(serverID string) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.waiting) >= q.maxQueued {
+		return 0, ErrQueueFull
+	}
+
+	q.waiting = append(q.waiting, serverID)
+	if len(q.waiting) == 1 && q.hasCapacityLocked() {
+		return 0, nil
+	}
+	return len(q.waiting), nil
+}
+
+// Acquire blocks until the build is first in the queue and there is capacity for it,
+// then removes it from the queue and takes a build slot. Release must be called once the build ends.
+func (q *BuildQueue) Acquire(serverID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for q.waiting[0] != serverID || !q.hasCapacityLocked() {
+		q.cond.Wait()
+	}
+
+	q.waiting = q.waiting[1:]
+	q.running++
+	// The next build may also fit
+	q.cond.Broadcast()
+}
+
+// Release frees the build slot taken by Acquire.
+func (q *BuildQueue) Release() {
+	q.mu.Lock()
+	q.running--
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+// Notify wakes waiting builds after the live server count went down.
+// The lock is taken so the wake up cannot slip between a capacity check and the wait.
+func (q *BuildQueue) Notify() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+// Running returns the number of builds in progress.
+func (q *BuildQueue) Running() int32 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.running
+}
+
+func (q *BuildQueue) hasCapacityLocked() bool {
+	return q.running < q.maxBuilds && q.running+q.liveServers() < q.maxAlive
+}
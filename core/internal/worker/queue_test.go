@@ -0,0 +1,121 @@
+package worker
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// acquired starts Acquire in the background and returns a channel closed once it returns.
+func acquired(q *BuildQueue, serverID string) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		q.Acquire(serverID)
+		close(done)
+	}()
+	return done
+}
+
+func assertBlocked(t *testing.T, done <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-done:
+		t.Fatalf("%s acquired a slot without capacity", what)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func assertAcquired(t *testing.T, done <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("%s still waits for a slot", what)
+	}
+}
+
+func TestBuildQueueEnqueuePositions(t *testing.T) {
+	q := NewBuildQueue(3, 1, 10, func() int32 { return 0 })
+
+	wantPositions := []int{0, 2, 3}
+	for i, serverID := range []string{"srv-1", "srv-2", "srv-3"} {
+		position, err := q.Enqueue(serverID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The first build starts right away, the others wait behind it
+		if position != wantPositions[i] {
+			t.Errorf("position of %s = %d, want %d", serverID, position, wantPositions[i])
+		}
+	}
+
+	if _, err := q.Enqueue("srv-4"); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Enqueue() over MaxQueuedBuilds error = %v, want ErrQueueFull", err)
+	}
+
+	// Starting a build makes room in the queue
+	q.Acquire("srv-1")
+	position, err := q.Enqueue("srv-4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if position != 3 {
+		t.Errorf("position of srv-4 = %d, want 3", position)
+	}
+}
+
+func TestBuildQueueReleaseWakesNextBuild(t *testing.T) {
+	q := NewBuildQueue(10, 1, 10, func() int32 { return 0 })
+	q.Enqueue("srv-1")
+	q.Enqueue("srv-2")
+	q.Acquire("srv-1")
+
+	second := acquired(q, "srv-2")
+	assertBlocked(t, second, "srv-2")
+
+	q.Release()
+	assertAcquired(t, second, "srv-2")
+	if running := q.Running(); running != 1 {
+		t.Errorf("%d builds running, want 1", running)
+	}
+}
+
+func TestBuildQueueNotifyWakesBuildOnFreeLiveSlot(t *testing.T) {
+	var live atomic.Int32
+	live.Store(2)
+	// Two live servers fill the limit, no build can start
+	q := NewBuildQueue(10, 2, 2, func() int32 { return live.Load() })
+
+	position, err := q.Enqueue("srv-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if position != 1 {
+		t.Errorf("position = %d, want the build queued behind the live servers", position)
+	}
+	build := acquired(q, "srv-1")
+	assertBlocked(t, build, "srv-1")
+
+	live.Store(1)
+	q.Notify()
+	assertAcquired(t, build, "srv-1")
+}
+
+func TestBuildQueueStartsBuildsInArrivalOrder(t *testing.T) {
+	q := NewBuildQueue(10, 1, 10, func() int32 { return 0 })
+	q.Enqueue("srv-1")
+	q.Enqueue("srv-2")
+	q.Enqueue("srv-3")
+	q.Acquire("srv-1")
+
+	// srv-3 is behind srv-2 and waits even when a slot is free
+	third := acquired(q, "srv-3")
+	second := acquired(q, "srv-2")
+	q.Release()
+	assertAcquired(t, second, "srv-2")
+	assertBlocked(t, third, "srv-3")
+
+	q.Release()
+	assertAcquired(t, third, "srv-3")
+}
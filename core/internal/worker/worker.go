@@ -2,82 +2,126 @@ package worker
 
 import (
 	config "beelder/internal/config/worker"
+	"beelder/internal/plans"
+	"beelder/internal/servertypes"
 	"beelder/internal/types"
 	"beelder/internal/worker/builder"
+	"beelder/pkg/messaging"
 	"beelder/pkg/messaging/redpanda"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"strconv"
+	"strings"
 	"sync/atomic"
-	"time"
-
-	"github.com/google/uuid"
-	"github.com/segmentio/kafka-go"
 )
 
 // Worker represents a worker that processes messages from a message broker,
 // builds servers, and manages concurrency limits.
 type Worker struct {
-	producer            *redpanda.RedpandaProducer
-	builder             *builder.Builder
-	logger              *slog.Logger
-	currentServerBuilds atomic.Int32
-	currentLiveServers  atomic.Int32
+	producer           messaging.Publisher
+	consumer           messaging.Subscriber
+	runtime            builder.ContainerRuntime
+	builder            *builder.Builder
+	monitor            *builder.Monitor
+	logger             *slog.Logger
+	buildQueue         *BuildQueue
+	currentLiveServers atomic.Int32
 }
 
-// NewWorker creates and returns a new Worker instance with initialized components.
-func NewWorker() *Worker {
+// NewWorker creates and returns a new Worker connected to Redpanda and Docker with the environment configuration.
+// A single Docker client is shared by every build.
+func NewWorker() (*Worker, error) {
+	if err := builder.ValidateJVMProfiles(config.WorkerEnvs.BuilderConfig.JVMProfiles); err != nil {
+		return nil, err
+	}
+
+	serverTypes, err := servertypes.Load(config.WorkerEnvs.ServerTypesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	catalog, err := plans.Load(config.WorkerEnvs.PlansFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := catalog.CheckServerTypes(serverTypes.Names()); err != nil {
+		return nil, err
+	}
+
+	runtime, err := builder.NewDockerRuntime(config.WorkerEnvs.DockerHost)
+	if err != nil {
+		return nil, err
+	}
+
 	producer := redpanda.NewRedpandaProducer(&redpanda.RedpandaConfig{
 		Brokers: []string{config.WorkerEnvs.Broker},
 		Topic:   config.WorkerEnvs.ProducerTopic,
 	})
 	producer.Connect()
-	return &Worker{
-		builder:  builder.NewBuilder(producer),
+
+	consumer := redpanda.NewRedpandaConsumer(&redpanda.RedpandaConsumerConfig{
+		Brokers: []string{config.WorkerEnvs.Broker},
+		Topic:   config.WorkerEnvs.ConsumerTopic,
+		GroupID: config.WorkerEnvs.GroupID,
+	})
+	consumer.Connect()
+
+	return New(producer, consumer, runtime, serverTypes, catalog), nil
+}
+
+// New creates a Worker that reads commands from consumer, publishes progress events with producer
+// and runs servers of the types defined in serverTypes, sized with the plans of catalog, on runtime.
+// The producer and the consumer must already be connected.
+func New(producer messaging.Publisher, consumer messaging.Subscriber, runtime builder.ContainerRuntime, serverTypes *servertypes.Registry, catalog *plans.Catalog) *Worker {
+	w := &Worker{
+		runtime:  runtime,
+		builder:  builder.NewBuilder(producer, runtime, serverTypes, catalog),
 		producer: producer,
+		consumer: consumer,
 		logger:   slog.Default().With("component", "worker"),
 	}
+	w.monitor = builder.NewMonitor(producer, runtime, w.serverDown)
+	w.buildQueue = NewBuildQueue(
+		int(config.WorkerEnvs.BuilderConfig.MaxQueuedBuilds),
+		config.WorkerEnvs.BuilderConfig.MaxConcurrentBuilds,
+		config.WorkerEnvs.BuilderConfig.MaxAliveServers,
+		w.currentLiveServers.Load,
+	)
+	return w
 }
 
 // handleCreateServer processes a "server.create" message.
-// It checks for concurrency limits, builds the server, and sends success or failure messages.
+// The build waits in the build queue until there is capacity for it, builds the server,
+// and sends queued, success or failure messages. Builds over the queue capacity are rejected.
 //
 // Returns a boolean indicating whether the message should be commited or not and an error if any occurred.
-func (w *Worker) handleCreateServer(message kafka.Message) (bool, error) {
-	if w.currentServerBuilds.Load() >= config.WorkerEnvs.BuilderConfig.MaxConcurrentBuilds {
-		w.logger.Warn("Max concurrent server builds reached, skipping message")
-		time.Sleep(5 * time.Second) // Wait before retrying
-		return false, nil
+// It only returns once the build reached a terminal state, so the message is not committed while it is queued.
+func (w *Worker) handleCreateServer(message messaging.Message) (bool, error) {
+	ctx := context.Background()
+	command := &types.ServerCommand{}
+	if err := json.Unmarshal(message.Value, command); err != nil {
+		w.logger.Error("Failed to unmarshal server command", "error", err)
+		return true, err
 	}
 
-	if w.currentLiveServers.Load() >= config.WorkerEnvs.BuilderConfig.MaxAliveServers {
-		w.logger.Warn("Max alive servers reached, skipping message")
-		time.Sleep(5 * time.Second) // Wait before retrying
-		return false, nil
+	if command.ServerID == "" {
+		w.logger.Error("Server command is missing a server id, dropping message", "correlation_id", command.CorrelationID)
+		return true, fmt.Errorf("server command without server id")
 	}
 
-	w.currentServerBuilds.Add(1)
-	defer w.currentServerBuilds.Add(-1)
-
-	ctx := context.Background()
-	serverId := uuid.New().String()
+	serverId := command.ServerID
 	createLogger := w.logger.With(
 		"server_id", serverId,
+		"correlation_id", command.CorrelationID,
 	)
 	createLogger.Info("Received create server message", "Value", string(message.Value))
 
-	w.producer.SendJsonMessage(
-		"server.create.started",
-		map[string]string{
-			"message": "Server creation started",
-			"status": "building",
-			"server_id": serverId,
-		},
-	)
-
-	serverConfig := &types.CreateServerConfig{}
-	if err := json.Unmarshal(message.Value, serverConfig); err != nil {
-		createLogger.Error("Failed to unmarshal server config", "error", err)
+	serverConfig := command.Config
+	if serverConfig == nil {
+		createLogger.Error("Server command is missing the server config")
 		w.producer.SendJsonMessage(
 			"server.create.failed",
 			map[string]string{
@@ -86,12 +130,52 @@ func (w *Worker) handleCreateServer(message kafka.Message) (bool, error) {
 				"server_id": serverId,
 			},
 		)
-		return true, err
+		return true, fmt.Errorf("server command without config")
+	}
+
+	position, err := w.buildQueue.Enqueue(serverId)
+	if err != nil {
+		createLogger.Warn("Build queue is full, rejecting server", "error", err)
+		w.producer.SendJsonMessage(
+			"server.create.rejected",
+			map[string]string{
+				"error": "No capacity available to build the server, try again later",
+				"status": "rejected_capacity",
+				"server_id": serverId,
+			},
+		)
+		return true, nil
 	}
 
+	if position > 0 {
+		createLogger.Info("Server build queued", "queue_position", position)
+		w.producer.SendJsonMessage(
+			"server.create.queued",
+			map[string]string{
+				"message": "Waiting for a free build slot",
+				"status": "queued",
+				"queue_position": strconv.Itoa(position),
+				"server_id": serverId,
+			},
+		)
+	}
+
+	w.buildQueue.Acquire(serverId)
+	defer w.buildQueue.Release()
+
+	w.producer.SendJsonMessage(
+		"server.create.started",
+		map[string]string{
+			"message": "Server creation started",
+			"status": "building",
+			"server_id": serverId,
+		},
+	)
+
 	createServerData := &types.CreateServerData{
-		ServerID:     serverId,
-		ServerConfig: serverConfig,
+		ServerID:      serverId,
+		CorrelationID: command.CorrelationID,
+		ServerConfig:  serverConfig,
 	}
 
 	createLogger = createLogger.With(
@@ -104,17 +188,18 @@ func (w *Worker) handleCreateServer(message kafka.Message) (bool, error) {
 		createLogger.Error("server build failed", "error", err)
 		w.producer.SendJsonMessage(
 			"server.create.failed",
-			map[string]string{
+			withFailureDiagnosis(map[string]string{
 				"error": "Failed to build server: " + err.Error(),
 				"status": "error",
 				"stage": stage,
 				"server_id": serverId,
-			},
+			}, err),
 		)
 		return true, err
 	}
 
 	w.currentLiveServers.Add(1)
+	w.watchServer(ctx, serverId)
 	createLogger.Info("server created successfully")
 	w.producer.SendJsonMessage(
 		"server.create.success",
@@ -122,21 +207,194 @@ func (w *Worker) handleCreateServer(message kafka.Message) (bool, error) {
 			"message": "Server created successfully",
 			"status": "running",
 			"server_id": serverId,
+			"container_id": createServerData.ContainerID,
+			"host": config.WorkerEnvs.PublicHost,
+			"port": strconv.Itoa(int(createServerData.Port)),
+		},
+	)
+	return true, nil
+}
+
+// lifecycleStatuses maps a lifecycle command to the status reported while it runs and once it succeeds.
+var lifecycleStatuses = map[string][2]string{
+	types.CommandStopServer:    {"stopping", "stopped"},
+	types.CommandStartServer:   {"starting", "running"},
+	types.CommandRestartServer: {"restarting", "running"},
+	types.CommandDeleteServer:  {"deleting", "deleted"},
+}
+
+// handleLifecycleCommand processes "server.stop", "server.start", "server.restart" and "server.delete" messages.
+// Progress is reported with "<command>.started", "<command>.success" and "<command>.failed" events.
+//
+// Returns a boolean indicating whether the message should be commited or not and an error if any occurred.
+func (w *Worker) handleLifecycleCommand(message messaging.Message) (bool, error) {
+	ctx := context.Background()
+	commandKey := string(message.Key)
+
+	command := &types.ServerCommand{}
+	if err := json.Unmarshal(message.Value, command); err != nil {
+		w.logger.Error("Failed to unmarshal server command", "error", err)
+		return true, err
+	}
+
+	if command.ServerID == "" {
+		w.logger.Error("Server command is missing a server id, dropping message", "correlation_id", command.CorrelationID)
+		return true, fmt.Errorf("server command without server id")
+	}
+
+	lifecycleLogger := w.logger.With(
+		"command", commandKey,
+		"server_id", command.ServerID,
+		"correlation_id", command.CorrelationID,
+	)
+	lifecycleLogger.Info("Received lifecycle command")
+
+	statuses := lifecycleStatuses[commandKey]
+	w.producer.SendJsonMessage(
+		commandKey+".started",
+		map[string]string{
+			"message": "Server " + statuses[0],
+			"status": statuses[0],
+			"server_id": command.ServerID,
+		},
+	)
+
+	if err, stage := w.runLifecycleCommand(ctx, commandKey, command); err != nil {
+		lifecycleLogger.Error("lifecycle command failed", "error", err, "stage", stage)
+		w.producer.SendJsonMessage(
+			commandKey+".failed",
+			withFailureDiagnosis(map[string]string{
+				"error": err.Error(),
+				"status": "error",
+				"stage": stage,
+				"server_id": command.ServerID,
+			}, err),
+		)
+		return true, err
+	}
+
+	lifecycleLogger.Info("lifecycle command completed")
+	w.producer.SendJsonMessage(
+		commandKey+".success",
+		map[string]string{
+			"message": "Server " + statuses[1],
+			"status": statuses[1],
+			"server_id": command.ServerID,
 		},
 	)
 	return true, nil
 }
 
+// withFailureDiagnosis adds the cause of a failed server startup to the fields of a failed event:
+// its "category", a human "explanation" and the last lines the server logged in "logs", one per line.
+// The fields are left as is when the error is not a startup failure.
+func withFailureDiagnosis(fields map[string]string, err error) map[string]string {
+	var startupErr *builder.StartupError
+	if errors.As(err, &startupErr) {
+		fields["category"] = string(startupErr.Category)
+		fields["explanation"] = startupErr.Explanation
+		fields["logs"] = strings.Join(startupErr.Logs, "\n")
+	}
+	return fields
+}
+
+// runLifecycleCommand executes a lifecycle command against the builder.
+// Returns an error and the stage where it happened if the command fails.
+func (w *Worker) runLifecycleCommand(ctx context.Context, commandKey string, command *types.ServerCommand) (error, string) {
+	switch commandKey {
+	case types.CommandStopServer:
+		return w.stopServer(ctx, command.ServerID)
+	case types.CommandStartServer:
+		return w.startServer(ctx, command.ServerID)
+	case types.CommandRestartServer:
+		if err, stage := w.stopServer(ctx, command.ServerID); err != nil {
+			return err, stage
+		}
+		return w.startServer(ctx, command.ServerID)
+	case types.CommandDeleteServer:
+		running, err := w.builder.IsServerRunning(ctx, command.ServerID)
+		if err != nil {
+			return err, "finding_server"
+		}
+		// Stop gracefully first so the world is saved even when the volumes are kept
+		if running {
+			if err, stage := w.stopServer(ctx, command.ServerID); err != nil {
+				return err, stage
+			}
+		}
+		return w.builder.DeleteServer(ctx, command.ServerID, command.VolumePolicy)
+	default:
+		return fmt.Errorf("unknown lifecycle command: %s", commandKey), "routing_command"
+	}
+}
+
+// stopServer stops a server and releases its live server slot.
+func (w *Worker) stopServer(ctx context.Context, serverID string) (error, string) {
+	// The monitor would report the exit as a crash
+	watched := w.monitor.Unwatch(serverID)
+
+	err, stage := w.builder.StopServer(ctx, serverID)
+	if err == nil {
+		w.currentLiveServers.Add(-1)
+		w.buildQueue.Notify()
+		return nil, stage
+	}
+
+	if watched {
+		// The server may have exited before the monitor reported it, its slot is released then
+		if running, runningErr := w.builder.IsServerRunning(ctx, serverID); runningErr == nil && !running {
+			w.serverDown(serverID)
+		} else {
+			w.watchServer(ctx, serverID)
+		}
+	}
+	return err, stage
+}
+
+// startServer starts a stopped server if the worker has room for another live server.
+func (w *Worker) startServer(ctx context.Context, serverID string) (error, string) {
+	if w.currentLiveServers.Add(1)+w.buildQueue.Running() > config.WorkerEnvs.BuilderConfig.MaxAliveServers {
+		w.currentLiveServers.Add(-1)
+		return fmt.Errorf("max alive servers reached"), "checking_capacity"
+	}
+
+	err, stage := w.builder.StartServer(ctx, serverID)
+	if err != nil {
+		w.currentLiveServers.Add(-1)
+		w.buildQueue.Notify()
+		return err, stage
+	}
+	w.watchServer(ctx, serverID)
+	return nil, stage
+}
+
+// watchServer makes the monitor watch a live server. A server the monitor can not find is only logged,
+// it keeps its live server slot until it is stopped.
+func (w *Worker) watchServer(ctx context.Context, serverID string) {
+	if err := w.monitor.Watch(ctx, serverID); err != nil {
+		w.logger.Error("Failed to watch server", "server_id", serverID, "error", err)
+	}
+}
+
+// serverDown releases the live server slot of a server that exited on its own.
+func (w *Worker) serverDown(serverID string) {
+	w.currentLiveServers.Add(-1)
+	w.buildQueue.Notify()
+	w.logger.Info("Server is down, live server slot released", "server_id", serverID)
+}
+
 // handleMessage processes incoming Kafka messages and routes them to the appropriate handler based on the message key.
 // It returns a boolean indicating whether the message should be committed or not and an error if any occurred.
-func (w *Worker) handleMessage(message kafka.Message) (bool, error) {
+func (w *Worker) handleMessage(message messaging.Message) (bool, error) {
 	// Implement the logic to handle incoming messages
 	w.logger.Info("Received message", "Value", string(message.Value))
 
 	msgType := message.Key
 	switch string(msgType) {
-	case "server.create":
+	case types.CommandCreateServer:
 		return w.handleCreateServer(message)
+	case types.CommandStopServer, types.CommandStartServer, types.CommandRestartServer, types.CommandDeleteServer:
+		return w.handleLifecycleCommand(message)
 	default:
 		w.logger.Warn("Unknown message type", "type", string(msgType))
 	}
@@ -144,20 +402,65 @@ func (w *Worker) handleMessage(message kafka.Message) (bool, error) {
 	return true, nil
 }
 
-// Start initializes the worker, connects to the message broker, and begins processing messages.
+// reconcile rebuilds the worker state from the server containers that survived a restart
+// and publishes a "server.reconciled" event for each of them so the API view matches reality.
+func (w *Worker) reconcile(ctx context.Context) error {
+	servers, err := w.builder.Reconcile(ctx)
+	if err != nil {
+		return err
+	}
+
+	var liveServers int32
+	for _, server := range servers {
+		status := "stopped"
+		if server.Running {
+			status = "running"
+			liveServers++
+			w.watchServer(ctx, server.ServerData.ServerID)
+		}
+
+		w.producer.SendJsonMessage(
+			"server.reconciled",
+			map[string]string{
+				"message": "Server state reconciled after worker restart",
+				"status": status,
+				"stage": "reconciled",
+				"server_id": server.ServerData.ServerID,
+				"container_id": server.ServerData.ContainerID,
+				"host": config.WorkerEnvs.PublicHost,
+				"port": strconv.Itoa(int(server.ServerData.Port)),
+			},
+		)
+	}
+
+	w.currentLiveServers.Store(liveServers)
+	w.buildQueue.Notify()
+	w.logger.Info("Reconciled existing servers", "servers", len(servers), "live_servers", liveServers)
+	return nil
+}
+
+// Start reconciles the existing servers and processes messages until Stop is called.
+// The live servers are monitored while the worker runs.
 func (w *Worker) Start() error {
 	// Implement the logic to start the worker
-	redpandaConsumer := redpanda.NewRedpandaConsumer(&redpanda.RedpandaConsumerConfig{
-		Brokers: []string{config.WorkerEnvs.Broker},
-		Topic:   config.WorkerEnvs.ConsumerTopic,
-		GroupID: config.WorkerEnvs.GroupID,
-	})
-	redpandaConsumer.Connect()
-	defer redpandaConsumer.Disconnect()
+	defer w.runtime.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := w.reconcile(ctx); err != nil {
+		return fmt.Errorf("failed to reconcile existing servers: %w", err)
+	}
+	go w.monitor.Run(ctx)
 
 	w.logger.Info("Worker started and listening for messages")
-	redpandaConsumer.ReadMessage(w.handleMessage)
+	err := w.consumer.ReadMessage(w.handleMessage)
 	w.logger.Info("Closing worker")
 
-	return nil
+	return err
+}
+
+// Stop disconnects the consumer, which makes Start return.
+func (w *Worker) Stop() {
+	w.consumer.Disconnect()
 }
@@ -0,0 +1,129 @@
+package worker
+
+import (
+	config "beelder/internal/config/worker"
+	"beelder/internal/plans"
+	"beelder/internal/servertypes"
+	"beelder/internal/worker/builder/fakeruntime"
+	"beelder/pkg/messaging/memory"
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+)
+
+// eventsTopic is the topic the test workers publish their events to.
+const eventsTopic = "events"
+
+// newTestWorker returns a worker running servers on runtime and publishing its events on bus,
+// with ports 45000-45009 and room for 10 live servers.
+func newTestWorker(t *testing.T, runtime *fakeruntime.Runtime, bus *memory.Bus) *Worker {
+	t.Helper()
+
+	config.Set(config.WorkerConfig{
+		PublicHost: "play.example.com",
+		BuilderConfig: config.BuilderConfig{
+			MaxConcurrentBuilds: 1,
+			MaxAliveServers:     10,
+			PortRangeStart:      45000,
+			PortRangeEnd:        45009,
+		},
+	})
+	serverTypes, err := servertypes.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog, err := plans.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(bus.Publisher(eventsTopic), bus.Subscriber("commands", "workers"), runtime, serverTypes, catalog)
+}
+
+// createServerContainer creates the container a previous worker built for a server on port,
+// labeled like the builder labels it, and leaves it running or exited.
+func createServerContainer(t *testing.T, runtime *fakeruntime.Runtime, serverID string, port int32, running bool) string {
+	t.Helper()
+
+	ctx := context.Background()
+	imageName := "ms-vanilla-2gb:1.21.1-java21-aikar"
+	runtime.AddImage(imageName)
+	resp, err := runtime.ContainerCreate(ctx,
+		&container.Config{
+			Image: imageName,
+			Labels: map[string]string{
+				"beelder.server_id":      serverID,
+				"beelder.server_type":    "vanilla",
+				"beelder.server_version": "1.21.1",
+				"beelder.ram_plan":       "2GB",
+				"beelder.port":           strconv.Itoa(int(port)),
+			},
+		},
+		&container.HostConfig{
+			PortBindings: nat.PortMap{"25565/tcp": []nat.PortBinding{{HostIP: "0.0.0.0", HostPort: strconv.Itoa(int(port))}}},
+		},
+		nil, nil, "ms-vanilla-2GB-"+serverID,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runtime.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !running {
+		if err := runtime.ContainerStop(ctx, resp.ID, container.StopOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.ID
+}
+
+func TestReconcileRebuildsWorkerState(t *testing.T) {
+	runtime := fakeruntime.New()
+	bus := memory.NewBus()
+	ports := map[string]int32{"srv-1": 45000, "srv-2": 45001, "srv-3": 45002}
+	containers := map[string]string{
+		"srv-1": createServerContainer(t, runtime, "srv-1", ports["srv-1"], true),
+		"srv-2": createServerContainer(t, runtime, "srv-2", ports["srv-2"], false),
+		"srv-3": createServerContainer(t, runtime, "srv-3", ports["srv-3"], true),
+	}
+
+	w := newTestWorker(t, runtime, bus)
+	if err := w.reconcile(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if live := w.currentLiveServers.Load(); live != 2 {
+		t.Errorf("%d live servers, want the 2 running servers", live)
+	}
+
+	// Only the running servers are monitored
+	for serverID, wantWatched := range map[string]bool{"srv-1": true, "srv-2": false, "srv-3": true} {
+		if watched := w.monitor.Unwatch(serverID); watched != wantWatched {
+			t.Errorf("%s watched = %v, want %v", serverID, watched, wantWatched)
+		}
+	}
+
+	wantStatuses := map[string]string{"srv-1": "running", "srv-2": "stopped", "srv-3": "running"}
+	messages := bus.Messages(eventsTopic)
+	if len(messages) != len(wantStatuses) {
+		t.Fatalf("%d events published, want one per server", len(messages))
+	}
+	for _, message := range messages {
+		var fields map[string]string
+		if err := json.Unmarshal(message.Value, &fields); err != nil {
+			t.Fatal(err)
+		}
+		serverID := fields["server_id"]
+		if string(message.Key) != "server.reconciled" || fields["status"] != wantStatuses[serverID] {
+			t.Errorf("%s event = %v, want server.reconciled with status %s", message.Key, fields, wantStatuses[serverID])
+		}
+		wantPort := strconv.Itoa(int(ports[serverID]))
+		if fields["container_id"] != containers[serverID] || fields["host"] != "play.example.com" || fields["port"] != wantPort {
+			t.Errorf("%s reconciled as %v, want container %s on play.example.com:%s", serverID, fields, containers[serverID], wantPort)
+		}
+	}
+}
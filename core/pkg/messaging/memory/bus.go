@@ -0,0 +1,238 @@
+// Package memory implements the messaging interfaces in process, so the API, the worker and the
+// SSE hub can exchange messages without a running broker.
+package memory
+
+import (
+	"beelder/pkg/messaging"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Bus holds topics in memory. Each topic has a single partition, every consumer group receives
+// every message of the topic and resumes from its last committed offset, like a Kafka consumer group.
+type Bus struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	topics map[string]*topic
+	logger *slog.Logger
+}
+
+type topic struct {
+	messages []messaging.Message
+	groups   map[string]*group
+}
+
+type group struct {
+	// committed is the offset of the next message the group has not committed
+	committed int64
+	// position is the offset of the next message to fetch, shared by the active sessions of the group
+	position int64
+	sessions int
+}
+
+// NewBus returns an empty bus.
+func NewBus() *Bus {
+	bus := &Bus{
+		topics: make(map[string]*topic),
+		logger: slog.Default().With("component", "memory_bus"),
+	}
+	bus.cond = sync.NewCond(&bus.mu)
+	return bus
+}
+
+// Publisher returns a publisher writing to the given topic.
+func (b *Bus) Publisher(topicName string) *Publisher {
+	return &Publisher{bus: b, topic: topicName}
+}
+
+// Subscriber returns a subscriber reading the given topic as part of the consumer group.
+func (b *Bus) Subscriber(topicName, groupID string) *Subscriber {
+	return &Subscriber{bus: b, topic: topicName, groupID: groupID}
+}
+
+// Messages returns a copy of every message published to the topic.
+func (b *Bus) Messages(topicName string) []messaging.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := b.topicLocked(topicName)
+	return append([]messaging.Message(nil), t.messages...)
+}
+
+// Committed returns the offset of the next message the consumer group has not committed.
+func (b *Bus) Committed(topicName, groupID string) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.groupLocked(topicName, groupID).committed
+}
+
+func (b *Bus) topicLocked(name string) *topic {
+	t, ok := b.topics[name]
+	if !ok {
+		t = &topic{groups: make(map[string]*group)}
+		b.topics[name] = t
+	}
+	return t
+}
+
+func (b *Bus) groupLocked(topicName, groupID string) *group {
+	t := b.topicLocked(topicName)
+	g, ok := t.groups[groupID]
+	if !ok {
+		g = &group{}
+		t.groups[groupID] = g
+	}
+	return g
+}
+
+func (b *Bus) publish(topicName string, message messaging.Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := b.topicLocked(topicName)
+	message.Topic = topicName
+	message.Partition = 0
+	message.Offset = int64(len(t.messages))
+	if message.Time.IsZero() {
+		message.Time = time.Now()
+	}
+	t.messages = append(t.messages, message)
+	b.cond.Broadcast()
+}
+
+// join starts a session of the consumer group. The first session rewinds the group to its committed offset,
+// so uncommitted messages are redelivered.
+func (b *Bus) join(topicName, groupID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g := b.groupLocked(topicName, groupID)
+	if g.sessions == 0 {
+		g.position = g.committed
+	}
+	g.sessions++
+}
+
+func (b *Bus) leave(topicName, groupID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.groupLocked(topicName, groupID).sessions--
+}
+
+// fetch blocks until the group has a message to fetch or the subscriber is closed.
+func (b *Bus) fetch(s *Subscriber) (messaging.Message, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := b.topicLocked(s.topic)
+	g := b.groupLocked(s.topic, s.groupID)
+	for !s.closed && g.position >= int64(len(t.messages)) {
+		b.cond.Wait()
+	}
+	if s.closed {
+		return messaging.Message{}, false
+	}
+
+	message := t.messages[g.position]
+	g.position++
+	return message, true
+}
+
+func (b *Bus) commit(topicName, groupID string, message messaging.Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g := b.groupLocked(topicName, groupID)
+	if message.Offset+1 > g.committed {
+		g.committed = message.Offset + 1
+	}
+}
+
+// Publisher implements messaging.Publisher on a Bus topic.
+type Publisher struct {
+	bus   *Bus
+	topic string
+}
+
+func (p *Publisher) SendMessage(message messaging.Message) error {
+	p.bus.publish(p.topic, message)
+	return nil
+}
+
+func (p *Publisher) SendJsonMessage(key string, value interface{}) error {
+	jsonValue, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message value: %w", err)
+	}
+
+	return p.SendMessage(messaging.Message{
+		Key:   []byte(key),
+		Value: jsonValue,
+	})
+}
+
+// Subscriber implements messaging.Subscriber on a Bus topic.
+type Subscriber struct {
+	bus     *Bus
+	topic   string
+	groupID string
+	// closed is guarded by the bus mutex
+	closed bool
+}
+
+// ReadMessage processes each message in its own goroutine until the subscriber is disconnected,
+// with the same in order commit semantics as the Redpanda consumer.
+func (s *Subscriber) ReadMessage(handler messaging.Handler) error {
+	s.bus.join(s.topic, s.groupID)
+	defer s.bus.leave(s.topic, s.groupID)
+
+	offsets := messaging.NewOffsetTracker()
+	// Commits are serialized so a lower offset is never committed after a higher one
+	var commitMu sync.Mutex
+	for {
+		m, ok := s.bus.fetch(s)
+		if !ok {
+			return nil // Subscriber disconnected
+		}
+		offsets.Track(m)
+
+		go func(msg messaging.Message) {
+			commit, err := handler(msg)
+			if err != nil {
+				s.bus.logger.Error("processing failed", "topic", s.topic, "group", s.groupID, "error", err)
+			}
+
+			if !commit {
+				return // Don't commit this message
+			}
+
+			commitMu.Lock()
+			defer commitMu.Unlock()
+
+			commitMsg, ok := offsets.Complete(msg)
+			if !ok {
+				return // Earlier messages are still being processed
+			}
+			s.bus.commit(s.topic, s.groupID, commitMsg)
+		}(m)
+	}
+}
+
+// Disconnect stops ReadMessage. A disconnected subscriber can not be reused.
+func (s *Subscriber) Disconnect() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	s.closed = true
+	s.bus.cond.Broadcast()
+}
+
+var (
+	_ messaging.Publisher  = (*Publisher)(nil)
+	_ messaging.Subscriber = (*Subscriber)(nil)
+)
@@ -0,0 +1,31 @@
+// Package messaging defines the broker agnostic interfaces used to publish and consume messages.
+// pkg/messaging/redpanda implements them on top of Redpanda/Kafka and pkg/messaging/memory in process.
+package messaging
+
+import "time"
+
+// Message is a message read from or written to a topic.
+type Message struct {
+	Topic     string
+	Partition int
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Time      time.Time
+}
+
+// Handler processes a message and returns whether it should be committed.
+type Handler func(Message) (bool, error)
+
+// Publisher writes messages to a single topic.
+type Publisher interface {
+	SendMessage(message Message) error
+	SendJsonMessage(key string, value interface{}) error
+}
+
+// Subscriber reads the messages of a single topic as part of a consumer group.
+type Subscriber interface {
+	// ReadMessage blocks processing messages with handler until the subscriber is disconnected.
+	ReadMessage(handler Handler) error
+	Disconnect()
+}
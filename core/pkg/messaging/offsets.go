@@ -0,0 +1,55 @@
+package messaging
+
+import "sync"
+
+// OffsetTracker orders commits of concurrently processed messages.
+// Committing an offset commits every message before it on the partition, so a message is only
+// released for commit once it and all the messages fetched before it are done.
+type OffsetTracker struct {
+	mu         sync.Mutex
+	partitions map[int]*partitionOffsets
+}
+
+type partitionOffsets struct {
+	inFlight []Message
+	done     map[int64]bool
+}
+
+// NewOffsetTracker returns an empty tracker.
+func NewOffsetTracker() *OffsetTracker {
+	return &OffsetTracker{
+		partitions: make(map[int]*partitionOffsets),
+	}
+}
+
+// Track registers a fetched message. Messages must be tracked in fetch order.
+func (t *OffsetTracker) Track(msg Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	partition, ok := t.partitions[msg.Partition]
+	if !ok {
+		partition = &partitionOffsets{done: make(map[int64]bool)}
+		t.partitions[msg.Partition] = partition
+	}
+	partition.inFlight = append(partition.inFlight, msg)
+}
+
+// Complete marks a message as done and returns the message to commit, if the
+// committed position of its partition can move forward.
+func (t *OffsetTracker) Complete(msg Message) (Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	partition := t.partitions[msg.Partition]
+	partition.done[msg.Offset] = true
+
+	var commit Message
+	var ok bool
+	for len(partition.inFlight) > 0 && partition.done[partition.inFlight[0].Offset] {
+		commit, ok = partition.inFlight[0], true
+		delete(partition.done, commit.Offset)
+		partition.inFlight = partition.inFlight[1:]
+	}
+	return commit, ok
+}
@@ -0,0 +1,41 @@
+package messaging
+
+import "testing"
+
+func TestOffsetTrackerCommitsInOrder(t *testing.T) {
+	message := func(partition int, offset int64) Message {
+		return Message{Topic: "server-commands", Partition: partition, Offset: offset}
+	}
+
+	tracker := NewOffsetTracker()
+	for offset := int64(10); offset < 14; offset++ {
+		tracker.Track(message(0, offset))
+	}
+	tracker.Track(message(1, 5))
+
+	steps := []struct {
+		complete   Message
+		wantCommit bool
+		wantOffset int64
+	}{
+		// Later jobs finishing first do not move the commit past offset 10, still running
+		{message(0, 12), false, 0},
+		{message(0, 11), false, 0},
+		// Other partitions commit on their own
+		{message(1, 5), true, 5},
+		// Offset 10 releases every finished offset after it
+		{message(0, 10), true, 12},
+		{message(0, 13), true, 13},
+	}
+
+	for _, step := range steps {
+		commit, ok := tracker.Complete(step.complete)
+		if ok != step.wantCommit {
+			t.Fatalf("Complete(partition %d, offset %d) commit = %v, want %v", step.complete.Partition, step.complete.Offset, ok, step.wantCommit)
+		}
+		if ok && (commit.Offset != step.wantOffset || commit.Partition != step.complete.Partition) {
+			t.Errorf("Complete(partition %d, offset %d) commits offset %d of partition %d, want offset %d",
+				step.complete.Partition, step.complete.Offset, commit.Offset, commit.Partition, step.wantOffset)
+		}
+	}
+}
@@ -1,8 +1,12 @@
 package redpanda
 
 import (
+	"beelder/pkg/messaging"
 	"context"
+	"errors"
+	"io"
 	"log/slog"
+	"sync"
 
 	"github.com/segmentio/kafka-go"
 )
@@ -15,6 +19,7 @@ type RedpandaConsumerConfig struct {
 	GroupID string
 }
 
+// RedpandaConsumer implements messaging.Subscriber on top of a Kafka consumer group reader.
 type RedpandaConsumer struct {
 	config *RedpandaConsumerConfig
 	reader *kafka.Reader
@@ -45,20 +50,40 @@ func (rc *RedpandaConsumer) Disconnect() {
 	}
 }
 
-func (rc *RedpandaConsumer) ReadMessage(callback func(kafka.Message) (bool, error)) error {
+// ReadMessage fetches messages and processes each of them in its own goroutine until the consumer is disconnected.
+// The handler returns whether the message should be committed. Offsets are committed in order,
+// a message is committed once it and every message fetched before it on its partition are done.
+// A message that is not committed holds back the commits of its partition, so it is redelivered
+// with the messages after it when the consumer group restarts.
+func (rc *RedpandaConsumer) ReadMessage(handler messaging.Handler) error {
 	ctx := context.Background()
+	offsets := messaging.NewOffsetTracker()
+	// Commits are serialized so a lower offset is never committed after a higher one
+	var commitMu sync.Mutex
 	for {
 		m, err := rc.reader.FetchMessage(ctx)
+		if errors.Is(err, io.EOF) {
+			return nil // Reader closed
+		}
 		if err != nil {
 			logger.Error("Error reading message", "error", err)
 			continue
 		}
 
 		logger.Info("Message received", "topic", m.Topic, "partition", m.Partition, "offset", m.Offset, "key", string(m.Key), "value", string(m.Value))
+		message := messaging.Message{
+			Topic:     m.Topic,
+			Partition: m.Partition,
+			Offset:    m.Offset,
+			Key:       m.Key,
+			Value:     m.Value,
+			Time:      m.Time,
+		}
+		offsets.Track(message)
 
 		// Process message in goroutine for concurrency
-		go func(msg kafka.Message) {
-			commit, err := callback(msg)
+		go func(msg messaging.Message) {
+			commit, err := handler(msg)
 			if err != nil {
 				logger.Error("processing failed", "error", err)
 			}
@@ -67,9 +92,21 @@ func (rc *RedpandaConsumer) ReadMessage(callback func(kafka.Message) (bool, erro
 				return // Don't commit this message
 			}
 
-			if err := rc.reader.CommitMessages(ctx, msg); err != nil {
+			commitMu.Lock()
+			defer commitMu.Unlock()
+
+			commitMsg, ok := offsets.Complete(msg)
+			if !ok {
+				return // Earlier messages are still being processed
+			}
+
+			if err := rc.reader.CommitMessages(ctx, kafka.Message{
+				Topic:     commitMsg.Topic,
+				Partition: commitMsg.Partition,
+				Offset:    commitMsg.Offset,
+			}); err != nil {
 				logger.Error("failed to commit messages", "error", err)
 			}
-		}(m)
+		}(message)
 	}
 }
@@ -1,6 +1,7 @@
 package redpanda
 
 import (
+	"beelder/pkg/messaging"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -13,6 +14,7 @@ type RedpandaConfig struct {
 	Topic  string
 }
 
+// RedpandaProducer implements messaging.Publisher on top of a Kafka writer.
 type RedpandaProducer struct {
 	config *RedpandaConfig
 	writer *kafka.Writer
@@ -34,10 +36,14 @@ func (rp *RedpandaProducer) Connect() {
 	fmt.Println("Connected to Redpanda")
 }
 
-func (rp *RedpandaProducer) SendMessage(message kafka.Message) error {
+func (rp *RedpandaProducer) SendMessage(message messaging.Message) error {
 	err := rp.writer.WriteMessages(
 		context.TODO(),
-		message,
+		kafka.Message{
+			Key:   message.Key,
+			Value: message.Value,
+			Time:  message.Time,
+		},
 	)
 	if err != nil {
 		return fmt.Errorf("failed to write messages: %w", err)
@@ -52,7 +58,7 @@ func (rp *RedpandaProducer) SendJsonMessage(key string, value interface{}) error
 		return fmt.Errorf("failed to marshal message value: %w", err)
 	}
 
-	message := kafka.Message{
+	message := messaging.Message{
 		Key:   []byte(key),
 		Value: jsonValue,
 	}
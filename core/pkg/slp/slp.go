@@ -0,0 +1,212 @@
+// Package slp implements the client side of the Minecraft Server List Ping protocol,
+// the status request a Minecraft client sends to show a server in its server list.
+//
+// See https://minecraft.wiki/w/Java_Edition_protocol/Server_List_Ping
+package slp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// protocolVersionUnknown is sent in the handshake when the client does not target a version,
+// servers answer the status request whatever their version.
+const protocolVersionUnknown = -1
+
+// maxPacketLength bounds the packets read from the server, a status response is a few KB.
+const maxPacketLength = 1 << 20
+
+const (
+	handshakePacketID = 0x00
+	statusPacketID    = 0x00
+	pingPacketID      = 0x01
+	nextStateStatus   = 1
+)
+
+// ErrInvalidResponse is returned when the server answers with something that is not a status response.
+var ErrInvalidResponse = errors.New("invalid server list ping response")
+
+// Status is the status response of a server.
+type Status struct {
+	Version struct {
+		Name     string `json:"name"`
+		Protocol int    `json:"protocol"`
+	} `json:"version"`
+	Players struct {
+		Max    int `json:"max"`
+		Online int `json:"online"`
+	} `json:"players"`
+	// Description is the message of the day, a string or a chat component.
+	Description json.RawMessage `json:"description"`
+	// Latency is the round trip time of the ping following the status request, zero when the server did not answer it.
+	Latency time.Duration `json:"-"`
+}
+
+// Ping sends a status request to the server at address ("host:port") and measures the latency.
+// An error means the server is not accepting clients yet, or is not a Minecraft server.
+// The context bounds the whole exchange.
+func Ping(ctx context.Context, address string) (*Status, error) {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q: %w", portString, err)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// Handshake then status request, sent together
+	var handshake bytes.Buffer
+	writeVarInt(&handshake, protocolVersionUnknown)
+	writeString(&handshake, host)
+	binary.Write(&handshake, binary.BigEndian, uint16(port))
+	writeVarInt(&handshake, nextStateStatus)
+
+	var request bytes.Buffer
+	writePacket(&request, handshakePacketID, handshake.Bytes())
+	writePacket(&request, statusPacketID, nil)
+	if _, err := conn.Write(request.Bytes()); err != nil {
+		return nil, fmt.Errorf("failed to send status request: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	packetID, payload, err := readPacket(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read status response: %w", err)
+	}
+	if packetID != statusPacketID {
+		return nil, fmt.Errorf("%w: packet id %#x", ErrInvalidResponse, packetID)
+	}
+	response, err := readString(bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+
+	var status Status
+	if err := json.Unmarshal([]byte(response), &status); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+
+	status.Latency = measureLatency(conn, reader)
+	return &status, nil
+}
+
+// measureLatency sends a ping the server echoes back and returns the round trip time.
+// The status response already tells the server is up, so a missing or wrong pong only leaves the latency unknown.
+func measureLatency(conn net.Conn, reader *bufio.Reader) time.Duration {
+	sentAt := time.Now()
+	var ping, request bytes.Buffer
+	binary.Write(&ping, binary.BigEndian, sentAt.UnixMilli())
+	writePacket(&request, pingPacketID, ping.Bytes())
+	if _, err := conn.Write(request.Bytes()); err != nil {
+		return 0
+	}
+
+	packetID, payload, err := readPacket(reader)
+	if err != nil || packetID != pingPacketID || !bytes.Equal(payload, ping.Bytes()) {
+		return 0
+	}
+	return time.Since(sentAt)
+}
+
+// writePacket writes a packet: its length, then its id and payload.
+func writePacket(w *bytes.Buffer, packetID int32, payload []byte) {
+	var body bytes.Buffer
+	writeVarInt(&body, packetID)
+	body.Write(payload)
+
+	writeVarInt(w, int32(body.Len()))
+	w.Write(body.Bytes())
+}
+
+// readPacket reads a packet and returns its id and payload.
+func readPacket(r *bufio.Reader) (int32, []byte, error) {
+	length, err := readVarInt(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	if length <= 0 || length > maxPacketLength {
+		return 0, nil, fmt.Errorf("%w: packet length %d", ErrInvalidResponse, length)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	bodyReader := bytes.NewReader(body)
+	packetID, err := readVarInt(bodyReader)
+	if err != nil {
+		return 0, nil, err
+	}
+	return packetID, body[len(body)-bodyReader.Len():], nil
+}
+
+// writeVarInt writes a VarInt, 7 bits per byte, least significant group first.
+func writeVarInt(w *bytes.Buffer, value int32) {
+	unsigned := uint32(value)
+	for {
+		if unsigned&^0x7F == 0 {
+			w.WriteByte(byte(unsigned))
+			return
+		}
+		w.WriteByte(byte(unsigned&0x7F | 0x80))
+		unsigned >>= 7
+	}
+}
+
+// readVarInt reads a VarInt of at most 5 bytes.
+func readVarInt(r io.ByteReader) (int32, error) {
+	var value uint32
+	for i := 0; i < 5; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		value |= uint32(b&0x7F) << (7 * i)
+		if b&0x80 == 0 {
+			return int32(value), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: VarInt is too long", ErrInvalidResponse)
+}
+
+// writeString writes a string prefixed with its length in bytes.
+func writeString(w *bytes.Buffer, value string) {
+	writeVarInt(w, int32(len(value)))
+	w.WriteString(value)
+}
+
+// readString reads a string prefixed with its length in bytes.
+func readString(r *bytes.Reader) (string, error) {
+	length, err := readVarInt(r)
+	if err != nil {
+		return "", err
+	}
+	if length < 0 || int(length) > r.Len() {
+		return "", fmt.Errorf("string length %d exceeds the packet", length)
+	}
+	value := make([]byte, length)
+	if _, err := io.ReadFull(r, value); err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
@@ -0,0 +1,277 @@
+package slp
+
+import (
+	"beelder/pkg/slp/slptest"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const testStatus = `{"version":{"name":"Paper 1.21.1","protocol":767},"players":{"max":20,"online":3},"description":{"text":"A Minecraft Server"}}`
+
+// startServer starts a fake server for the duration of the test.
+func startServer(t *testing.T, handler slptest.Handler) *slptest.Server {
+	t.Helper()
+	server, err := slptest.NewServer(handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	return server
+}
+
+// readStatusRequest reads the handshake and status request of the client.
+func readStatusRequest(t *testing.T, conn net.Conn) *bufio.Reader {
+	t.Helper()
+	reader := bufio.NewReader(conn)
+	for range 2 {
+		if _, _, err := slptest.ReadPacket(reader); err != nil {
+			t.Errorf("failed to read the status request: %v", err)
+		}
+	}
+	return reader
+}
+
+func ping(t *testing.T, address string) (*Status, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return Ping(ctx, address)
+}
+
+func TestPingSendsHandshakeAndStatusRequest(t *testing.T) {
+	type request struct {
+		packetID int32
+		payload  []byte
+	}
+	requests := make(chan request, 2)
+	server := startServer(t, func(conn net.Conn) {
+		reader := bufio.NewReader(conn)
+		for range 2 {
+			packetID, payload, err := slptest.ReadPacket(reader)
+			if err != nil {
+				t.Errorf("failed to read request: %v", err)
+				return
+			}
+			requests <- request{packetID, payload}
+		}
+	})
+
+	// The server never answers, only the request matters
+	ping(t, server.Addr)
+
+	host, portString, _ := net.SplitHostPort(server.Addr)
+	port, _ := strconv.Atoi(portString)
+	var want bytes.Buffer
+	writeVarInt(&want, protocolVersionUnknown)
+	writeString(&want, host)
+	binary.Write(&want, binary.BigEndian, uint16(port))
+	writeVarInt(&want, nextStateStatus)
+
+	handshake := <-requests
+	if handshake.packetID != handshakePacketID || !bytes.Equal(handshake.payload, want.Bytes()) {
+		t.Errorf("handshake = %#x %x, want %#x %x", handshake.packetID, handshake.payload, handshakePacketID, want.Bytes())
+	}
+	status := <-requests
+	if status.packetID != statusPacketID || len(status.payload) != 0 {
+		t.Errorf("status request = %#x %x, want %#x without payload", status.packetID, status.payload, statusPacketID)
+	}
+}
+
+func TestPingReturnsStatus(t *testing.T) {
+	server := startServer(t, slptest.StatusHandler(testStatus))
+
+	status, err := ping(t, server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Version.Name != "Paper 1.21.1" || status.Version.Protocol != 767 {
+		t.Errorf("version = %+v", status.Version)
+	}
+	if status.Players.Max != 20 || status.Players.Online != 3 {
+		t.Errorf("players = %+v", status.Players)
+	}
+	if string(status.Description) != `{"text":"A Minecraft Server"}` {
+		t.Errorf("description = %s", status.Description)
+	}
+	if status.Latency <= 0 {
+		t.Errorf("latency = %v, want the round trip of the echoed ping", status.Latency)
+	}
+}
+
+func TestPingLatency(t *testing.T) {
+	tests := []struct {
+		name string
+		// pong answers the ping payload of the client
+		pong func(conn net.Conn, payload []byte)
+	}{
+		{
+			name: "no pong",
+			pong: func(conn net.Conn, payload []byte) {},
+		},
+		{
+			name: "pong with another payload",
+			pong: func(conn net.Conn, payload []byte) {
+				slptest.WritePacket(conn, pingPacketID, make([]byte, len(payload)))
+			},
+		},
+		{
+			name: "pong with another packet id",
+			pong: func(conn net.Conn, payload []byte) {
+				slptest.WritePacket(conn, 0x02, payload)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startServer(t, func(conn net.Conn) {
+				reader := readStatusRequest(t, conn)
+				var response bytes.Buffer
+				writeString(&response, testStatus)
+				slptest.WritePacket(conn, statusPacketID, response.Bytes())
+
+				packetID, payload, err := slptest.ReadPacket(reader)
+				if err != nil || packetID != pingPacketID || len(payload) != 8 {
+					t.Errorf("ping = %#x %x, %v, want a ping packet with a long payload", packetID, payload, err)
+					return
+				}
+				tt.pong(conn, payload)
+			})
+
+			// The status alone tells the server is up
+			status, err := ping(t, server.Addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status.Latency != 0 {
+				t.Errorf("latency = %v, want 0 without a matching pong", status.Latency)
+			}
+		})
+	}
+}
+
+func TestPingRejectsInvalidResponses(t *testing.T) {
+	statusPayload := func(value string) []byte {
+		var payload bytes.Buffer
+		writeString(&payload, value)
+		return payload.Bytes()
+	}
+	packet := func(packetID int32, payload []byte) []byte {
+		var buf bytes.Buffer
+		writePacket(&buf, packetID, payload)
+		return buf.Bytes()
+	}
+	varInt := func(value int32) []byte {
+		var buf bytes.Buffer
+		writeVarInt(&buf, value)
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		name     string
+		response []byte
+		// invalid tells whether the error wraps ErrInvalidResponse, a cut connection does not
+		invalid bool
+	}{
+		{
+			name:     "truncated packet",
+			response: packet(statusPacketID, statusPayload(testStatus))[:20],
+		},
+		{
+			name:     "truncated length",
+			response: []byte{0x80},
+		},
+		{
+			name:     "empty response",
+			response: nil,
+		},
+		{
+			name:     "oversized varint",
+			response: []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x01},
+			invalid:  true,
+		},
+		{
+			name:     "oversized packet length",
+			response: varInt(maxPacketLength + 1),
+			invalid:  true,
+		},
+		{
+			name:     "negative packet length",
+			response: varInt(-1),
+			invalid:  true,
+		},
+		{
+			name:     "string length past the packet",
+			response: packet(statusPacketID, append(varInt(4096), `{"version":{}}`...)),
+			invalid:  true,
+		},
+		{
+			name:     "wrong packet id",
+			response: packet(0x02, statusPayload(testStatus)),
+			invalid:  true,
+		},
+		{
+			name:     "status is not JSON",
+			response: packet(statusPacketID, statusPayload("Minecraft server")),
+			invalid:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startServer(t, func(conn net.Conn) {
+				readStatusRequest(t, conn)
+				conn.Write(tt.response)
+			})
+
+			status, err := ping(t, server.Addr)
+			if err == nil {
+				t.Fatalf("Ping returned %+v, want an error", status)
+			}
+			if got := errors.Is(err, ErrInvalidResponse); got != tt.invalid {
+				t.Errorf("errors.Is(%v, ErrInvalidResponse) = %v, want %v", err, got, tt.invalid)
+			}
+		})
+	}
+}
+
+func TestPingTimesOut(t *testing.T) {
+	server := startServer(t, func(conn net.Conn) {
+		// Accept the request and never answer, until the client gives up
+		readStatusRequest(t, conn)
+		conn.Read(make([]byte, 1))
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := Ping(ctx, server.Addr); err == nil {
+		t.Fatal("Ping succeeded without a response")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Ping returned after %v, want the context deadline", elapsed)
+	}
+}
+
+func TestPingFailsWithoutServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	if _, err := ping(t, address); err == nil {
+		t.Fatal("Ping succeeded on a closed port")
+	}
+	if _, err := ping(t, "127.0.0.1:70000"); err == nil {
+		t.Fatal("Ping succeeded on an invalid port")
+	}
+}
@@ -0,0 +1,165 @@
+// Package slptest provides a fake Minecraft server answering Server List Pings on a local address,
+// for tests of the slp client and of the code probing servers with it.
+package slptest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// Handler serves a single connection, the connection is closed when it returns.
+type Handler func(conn net.Conn)
+
+// Server accepts connections on a local address and serves each of them with its handler.
+type Server struct {
+	// Addr is the "host:port" address the server listens on.
+	Addr     string
+	listener net.Listener
+	handler  Handler
+	wg       sync.WaitGroup
+}
+
+// NewServer starts a server on a free port of the loopback interface.
+func NewServer(handler Handler) (*Server, error) {
+	return NewServerAt("127.0.0.1:0", handler)
+}
+
+// NewServerAt starts a server on address, e.g. the port a starting Minecraft server was allocated.
+func NewServerAt(address string, handler Handler) (*Server, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		Addr:     listener.Addr().String(),
+		listener: listener,
+		handler:  handler,
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return // Listener closed
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.handler(conn)
+		}()
+	}
+}
+
+// Close stops accepting connections and waits for the connections being served.
+// Handlers blocked on a client that never writes block Close until the client gives up.
+func (s *Server) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+// StatusHandler answers like a Minecraft server: it reads the handshake and the status request, answers
+// with the status JSON, then echoes the ping of the client back.
+func StatusHandler(status string) Handler {
+	return func(conn net.Conn) {
+		reader := bufio.NewReader(conn)
+		// Handshake, then status request
+		for range 2 {
+			if _, _, err := ReadPacket(reader); err != nil {
+				return
+			}
+		}
+
+		var response bytes.Buffer
+		WriteString(&response, status)
+		if err := WritePacket(conn, 0x00, response.Bytes()); err != nil {
+			return
+		}
+
+		packetID, payload, err := ReadPacket(reader)
+		if err != nil || packetID != 0x01 {
+			return
+		}
+		WritePacket(conn, 0x01, payload)
+	}
+}
+
+// ReadPacket reads a packet sent by the client and returns its id and payload.
+func ReadPacket(r *bufio.Reader) (int32, []byte, error) {
+	length, err := readVarInt(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	if length <= 0 {
+		return 0, nil, fmt.Errorf("invalid packet length %d", length)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	bodyReader := bytes.NewReader(body)
+	packetID, err := readVarInt(bodyReader)
+	if err != nil {
+		return 0, nil, err
+	}
+	return packetID, body[len(body)-bodyReader.Len():], nil
+}
+
+// WritePacket writes a packet: its length, then its id and payload.
+func WritePacket(w io.Writer, packetID int32, payload []byte) error {
+	var body bytes.Buffer
+	WriteVarInt(&body, packetID)
+	body.Write(payload)
+
+	var packet bytes.Buffer
+	WriteVarInt(&packet, int32(body.Len()))
+	packet.Write(body.Bytes())
+	_, err := w.Write(packet.Bytes())
+	return err
+}
+
+// WriteVarInt writes a VarInt, 7 bits per byte, least significant group first.
+func WriteVarInt(w *bytes.Buffer, value int32) {
+	unsigned := uint32(value)
+	for {
+		if unsigned&^0x7F == 0 {
+			w.WriteByte(byte(unsigned))
+			return
+		}
+		w.WriteByte(byte(unsigned&0x7F | 0x80))
+		unsigned >>= 7
+	}
+}
+
+// WriteString writes a string prefixed with its length in bytes.
+func WriteString(w *bytes.Buffer, value string) {
+	WriteVarInt(w, int32(len(value)))
+	w.WriteString(value)
+}
+
+func readVarInt(r io.ByteReader) (int32, error) {
+	var value uint32
+	for i := 0; i < 5; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		value |= uint32(b&0x7F) << (7 * i)
+		if b&0x80 == 0 {
+			return int32(value), nil
+		}
+	}
+	return 0, errors.New("VarInt is too long")
+}
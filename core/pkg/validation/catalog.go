@@ -0,0 +1,202 @@
+package validation
+
+import (
+	"beelder/internal/plans"
+	"beelder/internal/servertypes"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// The catalogs backing the servertype, ramplan, mcversion, loaderversion and region tags, set by SetCatalog.
+// Until then the tags reject every value.
+var (
+	serverTypes *servertypes.Registry
+	planCatalog *plans.Catalog
+)
+
+// SetCatalog sets the server types and plans the tags validate against, the same ones the worker builds with.
+// It must be called before serving requests.
+//
+//   - servertype: a server type of the registry.
+//   - ramplan: a plan of the catalog. ramplan=ServerType also requires the plan to run the server type of the ServerType field.
+//   - mcversion=ServerType: a version supported by the server type of the ServerType field, matching servertypes.VersionPattern.
+//   - loaderversion=ServerType: a loader version matching servertypes.VersionPattern, for a server type of the
+//     ServerType field whose loader version can be pinned.
+//   - region: a region of the catalog. region=RamPlan also requires the plan of the RamPlan field to be offered in it.
+//
+// Combinations are only checked when the other field is valid, so an invalid server type is reported once.
+func SetCatalog(registry *servertypes.Registry, catalog *plans.Catalog) {
+	serverTypes = registry
+	planCatalog = catalog
+}
+
+func init() {
+	validate.RegisterValidation("servertype", validateServerType)
+	validate.RegisterValidation("ramplan", validateRamPlan)
+	validate.RegisterValidation("mcversion", validateMinecraftVersion)
+	validate.RegisterValidation("loaderversion", validateLoaderVersion)
+	validate.RegisterValidation("region", validateRegion)
+}
+
+// siblingString returns the string field of the parent struct named by the tag param.
+func siblingString(fl validator.FieldLevel) (string, bool) {
+	parent := fl.Parent()
+	if parent.Kind() == reflect.Pointer {
+		parent = parent.Elem()
+	}
+	field := parent.FieldByName(fl.Param())
+	if !field.IsValid() || field.Kind() != reflect.String {
+		return "", false
+	}
+	return field.String(), true
+}
+
+func validateServerType(fl validator.FieldLevel) bool {
+	if serverTypes == nil {
+		return false
+	}
+	_, err := serverTypes.Lookup(fl.Field().String())
+	return err == nil
+}
+
+func validateRamPlan(fl validator.FieldLevel) bool {
+	if planCatalog == nil || serverTypes == nil {
+		return false
+	}
+	plan, err := planCatalog.Lookup(fl.Field().String())
+	if err != nil {
+		return false
+	}
+	if fl.Param() == "" {
+		return true
+	}
+
+	serverType, ok := siblingString(fl)
+	if !ok {
+		return false
+	}
+	if _, err := serverTypes.Lookup(serverType); err != nil {
+		return true // Reported by the servertype tag
+	}
+	return plan.AllowsServerType(serverType)
+}
+
+func validateMinecraftVersion(fl validator.FieldLevel) bool {
+	if serverTypes == nil {
+		return false
+	}
+	// The version is part of the jar path and image tag of the server, whatever its server type
+	serverVersion := fl.Field().String()
+	if !servertypes.VersionPattern.MatchString(serverVersion) {
+		return false
+	}
+	serverType, ok := siblingString(fl)
+	if !ok {
+		return false
+	}
+	definition, err := serverTypes.Lookup(serverType)
+	if err != nil {
+		return true // Reported by the servertype tag
+	}
+
+	if !definition.SupportsVersion(serverVersion) {
+		return false
+	}
+	if definition.VersionScheme == servertypes.VersionSchemeNone {
+		return true
+	}
+	version, ok := definition.MinecraftVersion(serverVersion)
+	return ok && definition.SupportsMinecraftVersion(version)
+}
+
+func validateLoaderVersion(fl validator.FieldLevel) bool {
+	if serverTypes == nil {
+		return false
+	}
+	if !servertypes.VersionPattern.MatchString(fl.Field().String()) {
+		return false
+	}
+	serverType, ok := siblingString(fl)
+	if !ok {
+		return false
+	}
+	definition, err := serverTypes.Lookup(serverType)
+	if err != nil {
+		return true // Reported by the servertype tag
+	}
+	return definition.LoaderVersion
+}
+
+func validateRegion(fl validator.FieldLevel) bool {
+	if planCatalog == nil {
+		return false
+	}
+	region := fl.Field().String()
+	if !planCatalog.HasRegion(region) {
+		return false
+	}
+	if fl.Param() == "" {
+		return true
+	}
+
+	planName, ok := siblingString(fl)
+	if !ok {
+		return false
+	}
+	plan, err := planCatalog.Lookup(planName)
+	if err != nil {
+		return true // Reported by the ramplan tag
+	}
+	return plan.AvailableIn(region)
+}
+
+const versionCharsetMsg = "Must be letters, digits, '.', '_' or '-', starting with a letter or digit, at most 128 characters"
+
+// catalogErrorMsg returns the message of a failed catalog tag, or false for other tags.
+func catalogErrorMsg(fe validator.FieldError) (string, bool) {
+	value, _ := fe.Value().(string)
+	other := toJSONName(fe.Param())
+
+	switch fe.Tag() {
+	case "servertype":
+		if serverTypes == nil {
+			return "Server types are not loaded", true
+		}
+		return "Must be one of: " + strings.Join(serverTypes.Names(), " "), true
+	case "ramplan":
+		if planCatalog == nil {
+			return "Plans are not loaded", true
+		}
+		if _, err := planCatalog.Lookup(value); err != nil {
+			return "Must be one of: " + strings.Join(planCatalog.Names(), " "), true
+		}
+		return "This plan does not run the selected " + other, true
+	case "mcversion":
+		if serverTypes == nil {
+			return "Server types are not loaded", true
+		}
+		if !servertypes.VersionPattern.MatchString(value) {
+			return versionCharsetMsg, true
+		}
+		return "Not a version supported by the selected " + other, true
+	case "loaderversion":
+		if serverTypes == nil {
+			return "Server types are not loaded", true
+		}
+		if !servertypes.VersionPattern.MatchString(value) {
+			return versionCharsetMsg, true
+		}
+		return "The loader version can not be pinned for the selected " + other, true
+	case "region":
+		if planCatalog == nil {
+			return "Plans are not loaded", true
+		}
+		if !planCatalog.HasRegion(value) {
+			return "Must be one of: " + strings.Join(planCatalog.Regions(), " "), true
+		}
+		return "The selected " + other + " is not offered in this region", true
+	}
+	return "", false
+}
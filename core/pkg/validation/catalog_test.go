@@ -0,0 +1,203 @@
+package validation
+
+import (
+	"beelder/internal/plans"
+	"beelder/internal/servertypes"
+	"beelder/internal/types"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func loadTestCatalog(t *testing.T) (*servertypes.Registry, *plans.Catalog) {
+	t.Helper()
+	registry, err := servertypes.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog, err := plans.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetCatalog(registry, catalog)
+	t.Cleanup(func() { SetCatalog(nil, nil) })
+	return registry, catalog
+}
+
+func TestValidateCreateServerConfig(t *testing.T) {
+	registry, catalog := loadTestCatalog(t)
+	serverTypesMsg := "Must be one of: " + strings.Join(registry.Names(), " ")
+	plansMsg := "Must be one of: " + strings.Join(catalog.Names(), " ")
+	regionsMsg := "Must be one of: " + strings.Join(catalog.Regions(), " ")
+
+	// valid returns a valid config changed by edit
+	valid := func(edit func(c *types.CreateServerConfig)) types.CreateServerConfig {
+		config := types.CreateServerConfig{
+			Name:          "My Server",
+			ServerType:    "fabric",
+			ServerVersion: "1.21.1",
+			LoaderVersion: "0.16.5",
+			Region:        "eu-west-1",
+			PlayerCount:   5,
+			RamPlan:       "4GB",
+			Difficulty:    "normal",
+		}
+		edit(&config)
+		return config
+	}
+
+	tests := []struct {
+		name   string
+		config types.CreateServerConfig
+		want   []ValidationError
+	}{
+		{
+			name:   "valid config",
+			config: valid(func(c *types.CreateServerConfig) {}),
+		},
+		{
+			// The combinations with the server type are not reported again
+			name:   "unknown server type",
+			config: valid(func(c *types.CreateServerConfig) { c.ServerType = "bukkit" }),
+			want:   []ValidationError{{Field: "ServerType", Message: serverTypesMsg}},
+		},
+		{
+			name:   "version below the oldest of the server type",
+			config: valid(func(c *types.CreateServerConfig) { c.ServerVersion = "1.12.2" }),
+			want:   []ValidationError{{Field: "ServerVersion", Message: "Not a version supported by the selected serverType"}},
+		},
+		{
+			name:   "version with a path",
+			config: valid(func(c *types.CreateServerConfig) { c.ServerVersion = "1.21.1/../x" }),
+			want:   []ValidationError{{Field: "ServerVersion", Message: versionCharsetMsg}},
+		},
+		{
+			name: "version too long for an image tag",
+			config: valid(func(c *types.CreateServerConfig) {
+				c.ServerType = "vanilla"
+				c.LoaderVersion = ""
+				c.ServerVersion = "1.21.1-" + strings.Repeat("a", 128)
+			}),
+			want: []ValidationError{{Field: "ServerVersion", Message: versionCharsetMsg}},
+		},
+		{
+			name: "loader version of a server type without a pinnable loader",
+			config: valid(func(c *types.CreateServerConfig) {
+				c.ServerType = "paper"
+				c.ServerVersion = "1.21.1"
+			}),
+			want: []ValidationError{{Field: "LoaderVersion", Message: "The loader version can not be pinned for the selected serverType"}},
+		},
+		{
+			name:   "loader version with a shell command",
+			config: valid(func(c *types.CreateServerConfig) { c.LoaderVersion = "0.16.5;reboot" }),
+			want:   []ValidationError{{Field: "LoaderVersion", Message: versionCharsetMsg}},
+		},
+		{
+			name:   "unknown plan",
+			config: valid(func(c *types.CreateServerConfig) { c.RamPlan = "3GB" }),
+			want:   []ValidationError{{Field: "RamPlan", Message: plansMsg}},
+		},
+		{
+			name: "plan not running the server type",
+			config: valid(func(c *types.CreateServerConfig) {
+				c.ServerType = "forge"
+				c.ServerVersion = "1.20.1-47.2.0"
+				c.LoaderVersion = ""
+				c.RamPlan = "2GB"
+			}),
+			want: []ValidationError{{Field: "RamPlan", Message: "This plan does not run the selected serverType"}},
+		},
+		{
+			name:   "unknown region",
+			config: valid(func(c *types.CreateServerConfig) { c.Region = "mars-1" }),
+			want:   []ValidationError{{Field: "Region", Message: regionsMsg}},
+		},
+		{
+			name: "plan not offered in the region",
+			config: valid(func(c *types.CreateServerConfig) {
+				c.RamPlan = "12GB"
+				c.Region = "sa-east-1"
+			}),
+			want: []ValidationError{{Field: "Region", Message: "The selected ramPlan is not offered in this region"}},
+		},
+		{
+			name: "every catalog field invalid",
+			config: valid(func(c *types.CreateServerConfig) {
+				c.ServerType = ""
+				c.RamPlan = "3GB"
+				c.Region = "mars-1"
+			}),
+			want: []ValidationError{
+				{Field: "ServerType", Message: "This field is required"},
+				{Field: "Region", Message: regionsMsg},
+				{Field: "RamPlan", Message: plansMsg},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidateStruct(&tt.config); !slices.Equal(got, tt.want) {
+				t.Errorf("ValidateStruct() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateRecommendationParams(t *testing.T) {
+	_, catalog := loadTestCatalog(t)
+
+	tests := []struct {
+		name   string
+		params types.RecommendationServerParams
+		want   []ValidationError
+	}{
+		{
+			name:   "valid params",
+			params: types.RecommendationServerParams{PlayerCount: 5, ServerType: "neoforge", Region: "sa-east-1", ServerVersion: "21.1.77"},
+		},
+		{
+			// Every plan is ranked, the region is not checked against one
+			name:   "region without a plan",
+			params: types.RecommendationServerParams{PlayerCount: 5, ServerType: "vanilla", Region: "mars-1"},
+			want:   []ValidationError{{Field: "Region", Message: "Must be one of: " + strings.Join(catalog.Regions(), " ")}},
+		},
+		{
+			name:   "unsupported version",
+			params: types.RecommendationServerParams{PlayerCount: 5, ServerType: "neoforge", Region: "eu-west-1", ServerVersion: "20.1.0"},
+			want:   []ValidationError{{Field: "ServerVersion", Message: "Not a version supported by the selected serverType"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidateStruct(&tt.params); !slices.Equal(got, tt.want) {
+				t.Errorf("ValidateStruct() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateWithoutCatalog(t *testing.T) {
+	SetCatalog(nil, nil)
+
+	config := types.CreateServerConfig{
+		Name:          "My Server",
+		ServerType:    "vanilla",
+		ServerVersion: "1.21.1",
+		Region:        "eu-west-1",
+		PlayerCount:   5,
+		RamPlan:       "2GB",
+		Difficulty:    "normal",
+	}
+	want := []ValidationError{
+		{Field: "ServerVersion", Message: "Server types are not loaded"},
+		{Field: "ServerType", Message: "Server types are not loaded"},
+		{Field: "Region", Message: "Plans are not loaded"},
+		{Field: "RamPlan", Message: "Plans are not loaded"},
+	}
+	if got := ValidateStruct(&config); !slices.Equal(got, want) {
+		t.Errorf("ValidateStruct() = %+v, want %+v", got, want)
+	}
+}
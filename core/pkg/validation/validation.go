@@ -91,6 +91,10 @@ func getErrorMsg(fe validator.FieldError) string {
 	fieldName := toJSONName(fe.Field())
 	feParam := toJSONName(fe.Param())
 
+	if msg, ok := catalogErrorMsg(fe); ok {
+		return msg
+	}
+
 	switch fe.Tag() {
 	case "required":
 		return "This field is required"